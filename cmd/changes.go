@@ -1,10 +1,16 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	cf "github.com/aws/aws-sdk-go-v2/service/cloudformation"
 	cfTypes "github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
 
 	"github.com/danpizz/giff/pkg"
@@ -13,7 +19,7 @@ import (
 
 func NewChangesCmd(cfClient pkg.CFAPI, apiClient pkg.API) *cobra.Command {
 	changesCmd := &cobra.Command{
-		Use:   "changes {stackname template-file [-p par1=val1 ... | -a par1=val1 ...] [--no-delete-changeset] | stack_arn} [--dump] [-v]",
+		Use:   "changes {stackname template-file [-p par1=val1 ... | -a par1=val1 ...] [--parameters-file file] [--tags-file file] [--capabilities cap1,cap2] [--changeset-config file] [--role-arn arn] [--notification-arns arn1,arn2] [--rollback-configuration json] [--description text] [--client-token token] [--include-nested-stacks=false] [--import resources.json] [--s3-bucket bucket [--s3-prefix prefix]] [--no-delete-changeset] | stack_arn} [--wait-timeout duration] [--dump | --output json] [-v]",
 		Short: "Show a human redable list of Cloudformation changes",
 		Long:  "Create a temporary changeset and display an easy to read summary of the changes created by deploying a local template and some (optional) parameters",
 		Run: func(cmd *cobra.Command, args []string) {
@@ -23,14 +29,31 @@ func NewChangesCmd(cfClient pkg.CFAPI, apiClient pkg.API) *cobra.Command {
 			}
 		},
 		Args: func(cmd *cobra.Command, args []string) error {
+			if Output != outputText && Output != outputJson {
+				return fmt.Errorf("invalid output format %q, must be %q or %q", Output, outputText, outputJson)
+			}
+			if Output == outputJson && Dump {
+				return fmt.Errorf("--dump cannot be used with --output %s", outputJson)
+			}
+			if WaitTimeout <= 0 {
+				return fmt.Errorf("--wait-timeout must be positive")
+			}
+			if err := validateCapabilities(Capabilities); err != nil {
+				return err
+			}
 			switch len(args) {
 			case 1:
-				if Parameters != "" || ParametersOverride != "" || NoDeleteChangeset {
-					return fmt.Errorf("unaccepted flag")
+				for _, name := range changeSetFlags {
+					if cmd.Flags().Changed(name) {
+						return fmt.Errorf("unaccepted flag --%s with a changeset arn", name)
+					}
 				}
 				ChangesetArn = args[0]
 				return nil
 			case 2:
+				if S3Prefix != "" && S3Bucket == "" {
+					return fmt.Errorf("--s3-prefix requires --s3-bucket")
+				}
 				StackName = args[0]
 				TemplateFileName = args[1]
 				return nil
@@ -38,31 +61,86 @@ func NewChangesCmd(cfClient pkg.CFAPI, apiClient pkg.API) *cobra.Command {
 			return fmt.Errorf("accepts 1 or 2 args, received %d", len(args))
 		},
 		Example: "giff change my-stack my-template.yaml -a Size=m4.tiny -v --no-delete-changeset\n" +
-			"giff change arn:aws:cloudformation:us-east-1:123456789012:changeSet/SampleChangeSet-direct/1a2345b6-0000-00a0-a123-00abc0abc000 --dump",
+			"giff change arn:aws:cloudformation:us-east-1:123456789012:changeSet/SampleChangeSet-direct/1a2345b6-0000-00a0-a123-00abc0abc000 --dump\n" +
+			"giff change my-stack my-template.yaml -o json\n" +
+			"giff change my-stack my-template.yaml -p Filter=a=b -p 'Subnets=\"subnet-1, subnet-2\"'\n" +
+			"giff change my-stack my-template.yaml --parameters-file parameters.json -p Size=m4.large\n" +
+			"giff change my-stack my-template.yaml --capabilities CAPABILITY_IAM\n" +
+			"giff change my-stack my-template.yaml --role-arn arn:aws:iam::123456789012:role/deploy --include-nested-stacks=false\n" +
+			"giff change my-stack my-template.yaml --import resources-to-import.json\n" +
+			"giff change my-stack my-big-template.yaml --s3-bucket my-bucket --s3-prefix templates\n" +
+			"giff change my-stack s3://my-bucket/templates/my-template.yaml\n" +
+			"giff change my-stack my-nested-stacks.yaml --wait-timeout 30m",
 	}
-	changesCmd.Flags().StringVarP(&Parameters, "all-parameters", "a", "", "All the template parameters: \"par1=value1 par2=value2 ...\"")
-	changesCmd.Flags().StringVarP(&ParametersOverride, "parameters-overrides", "p", "", "The input parameters for your stack template. If you don't specify a parameter, the stack's existing value is used. \"par1=value1 para2=value2 ...\"")
-	changesCmd.Flags().StringVarP(&Tags, "tags", "t", "", "The tags parameters to associate to the stack. \"tag1=value1 tag2=value2 ...\"")
+	changesCmd.Flags().StringArrayVarP(&Parameters, "all-parameters", "a", nil, "All the template parameters, can be repeated: \"par1=value1 par2='value 2' ...\"")
+	changesCmd.Flags().StringArrayVarP(&ParametersOverride, "parameters-overrides", "p", nil, "The input parameters for your stack template, can be repeated. If you don't specify a parameter, the stack's existing value is used. \"par1=value1 par2='value 2' ...\"")
+	changesCmd.Flags().StringArrayVarP(&Tags, "tags", "t", nil, "The tags parameters to associate to the stack, can be repeated. \"tag1=value1 tag2='value 2' ...\"")
+	changesCmd.Flags().StringVar(&ParametersFileName, "parameters-file", "", "File with the parameters, merged with -a or -p that take precedence: AWS CLI JSON [{\"ParameterKey\":\"par1\",\"ParameterValue\":\"value1\"}] or [\"par1=value1\"], CodePipeline template configuration {\"Parameters\":{\"par1\":\"value1\"}} or par1=value1 lines")
+	changesCmd.Flags().StringVar(&TagsFileName, "tags-file", "", "File with the tags, merged with -t that takes precedence: AWS CLI JSON [{\"Key\":\"tag1\",\"Value\":\"value1\"}], CodePipeline template configuration {\"Tags\":{\"tag1\":\"value1\"}} or tag1=value1 lines")
+	changesCmd.Flags().StringSliceVar(&Capabilities, "capabilities", nil, "The capabilities of the changeset, like CAPABILITY_IAM,CAPABILITY_AUTO_EXPAND. By default they are detected from the IAM resources, transforms and nested stacks of the template")
+	changesCmd.Flags().StringVar(&ChangeSetConfigFileName, "changeset-config", "", "JSON file with the changeset options, overridden by their flags: {\"RoleARN\":\"arn\",\"NotificationARNs\":[\"arn\"],\"RollbackConfiguration\":{...},\"Description\":\"text\",\"ClientToken\":\"token\",\"IncludeNestedStacks\":false}")
+	changesCmd.Flags().StringVar(&RoleARN, "role-arn", "", "The ARN of the IAM role CloudFormation assumes to create the changeset")
+	changesCmd.Flags().StringSliceVar(&NotificationARNs, "notification-arns", nil, "The ARNs of the SNS topics notified of the stack events")
+	changesCmd.Flags().StringVar(&RollbackConfiguration, "rollback-configuration", "", "The rollback triggers, in the JSON format of the AWS CLI: {\"RollbackTriggers\":[{\"Arn\":\"arn\",\"Type\":\"AWS::CloudWatch::Alarm\"}],\"MonitoringTimeInMinutes\":10}")
+	changesCmd.Flags().StringVar(&ChangeSetDescription, "description", "", "The description of the changeset")
+	changesCmd.Flags().StringVar(&ClientToken, "client-token", "", "A unique identifier of the CreateChangeSet request, to retry it safely")
+	changesCmd.Flags().BoolVar(&IncludeNestedStacks, "include-nested-stacks", true, "Create changesets for the nested stacks too")
+	changesCmd.Flags().StringVar(&ImportFileName, "import", "", "Create an IMPORT changeset with the resources listed in a JSON file: [{\"ResourceType\":\"AWS::S3::Bucket\",\"LogicalResourceId\":\"Bucket\",\"ResourceIdentifier\":{\"BucketName\":\"my-bucket\"}}]")
+	changesCmd.Flags().StringVar(&S3Bucket, "s3-bucket", "", "Upload the template to this S3 bucket and create the changeset with its URL, needed for templates bigger than 51200 bytes")
+	changesCmd.Flags().StringVar(&S3Prefix, "s3-prefix", "", "Prefix of the name of the template uploaded with --s3-bucket")
+	changesCmd.Flags().StringVar(&S3Endpoint, "s3-endpoint", "", "Custom S3 endpoint URL, for S3 compatible services")
+	changesCmd.Flags().DurationVar(&WaitTimeout, "wait-timeout", pkg.DefaultWaitTimeout, "Maximum time to wait for the changeset to be created, like 90s or 30m")
 	changesCmd.Flags().BoolVar(&NoDeleteChangeset, "no-delete-changeset", false, "Don't remove the changeset, print its ARN")
 	changesCmd.Flags().BoolVarP(&Dump, "dump", "d", false, "Print the raw changeset")
+	changesCmd.Flags().StringVarP(&Output, "output", "o", outputText, "Output format: \"text\" or \"json\"")
 	return changesCmd
 }
 
 var TemplateFileName string
 var StackName string
 
-var Parameters string
-var ParametersOverride string
-var Tags string
+var Parameters []string
+var ParametersOverride []string
+var Tags []string
+var ParametersFileName string
+var TagsFileName string
+var Capabilities []string
+var ChangeSetConfigFileName string
+var RoleARN string
+var NotificationARNs []string
+var RollbackConfiguration string
+var ChangeSetDescription string
+var ClientToken string
+var IncludeNestedStacks bool = true
+var ImportFileName string
+var S3Bucket string
+var S3Prefix string
+var S3Endpoint string
+var WaitTimeout time.Duration
 var NoDeleteChangeset bool = false
 var ChangesetArn string
 var Dump bool = false
+var Output string
+
+// changeSetFlags are the flags that describe a new changeset, not accepted
+// with the ARN of an existing one
+var changeSetFlags = []string{
+	"all-parameters", "parameters-overrides", "parameters-file", "tags", "tags-file", "capabilities",
+	"changeset-config", "role-arn", "notification-arns", "rollback-configuration", "description", "client-token", "include-nested-stacks",
+	"import", "s3-bucket", "s3-prefix", "s3-endpoint", "no-delete-changeset",
+}
+
+const (
+	outputText = "text"
+	outputJson = "json"
+)
 
 func init() {
 	rootCmd.AddCommand(NewChangesCmd(nil, nil))
 }
 
 func changes(cmd *cobra.Command, cfClient pkg.CFAPI, apiClient pkg.API) (err error) {
+	ctx := commandContext(cmd)
 	if cfClient == nil {
 		cfClient, err = pkg.NewCFClient()
 		if err != nil {
@@ -70,80 +148,288 @@ func changes(cmd *cobra.Command, cfClient pkg.CFAPI, apiClient pkg.API) (err err
 		}
 	}
 	if apiClient == nil {
-		apiClient = pkg.APIClient{}
+		apiClient = pkg.APIClient{S3Endpoint: S3Endpoint}
 	}
 
 	var parameters []cfTypes.Parameter
+	var template pkg.Template
 	var tags []cfTypes.Tag
 	var changesetArn string
+	var newStack bool
+	// createdStack is the REVIEW_IN_PROGRESS stack created by this changeset
+	var createdStack bool
+	// the temporary resources are deleted also on errors and interrupts
+	var resources temporaryResources
+	defer func() {
+		if cleanupErr := resources.delete(cmd, cfClient, apiClient); err == nil {
+			err = cleanupErr
+		}
+	}()
 	if ChangesetArn != "" {
 		changesetArn = ChangesetArn
 	} else {
-		if ParametersOverride != "" || (Parameters == "" && ParametersOverride == "") {
-			stackParameters, err := pkg.GetStackParameters(cfClient, aws.String(StackName))
+		allParameters, err := parameterListFromFlag(Parameters)
+		if err != nil {
+			return err
+		}
+		parametersOverride, err := parameterListFromFlag(ParametersOverride)
+		if err != nil {
+			return err
+		}
+		if ParametersFileName != "" {
+			data, err := ioutil.ReadFile(ParametersFileName)
 			if err != nil {
 				return err
 			}
-			p := pkg.ParameterListFromString(ParametersOverride)
-			parameters, err = pkg.OverrideParameters(stackParameters, p)
+			fileParameters, err := pkg.ParametersFromFile(data)
+			if err != nil {
+				return fmt.Errorf("%s: %w", ParametersFileName, err)
+			}
+			// the file parameters are all the parameters with -a, otherwise overrides
+			if len(Parameters) > 0 {
+				allParameters = pkg.MergeParameters(fileParameters, allParameters)
+			} else {
+				parametersOverride = pkg.MergeParameters(fileParameters, parametersOverride)
+			}
+		}
+
+		if TagsFileName != "" {
+			data, err := ioutil.ReadFile(TagsFileName)
 			if err != nil {
 				return err
 			}
-		} else {
-			parameters = pkg.ParameterListFromString(Parameters)
+			tags, err = pkg.TagsFromFile(data)
+			if err != nil {
+				return fmt.Errorf("%s: %w", TagsFileName, err)
+			}
 		}
+		flagTags, err := tagListFromFlag(Tags)
+		if err != nil {
+			return err
+		}
+		tags = pkg.MergeTags(tags, flagTags)
 
-		if Tags != "" {
-			tags = pkg.TagListFromString(Tags)
+		templateBody, err := apiClient.ReadTemplateFile(ctx, TemplateFileName)
+		if err != nil {
+			return err
 		}
+		// a template that can't be parsed is reported by CloudFormation, the
+		// parameters are not reconciled and validated
+		template, _ = pkg.ParseTemplate([]byte(templateBody))
 
-		PrintfV("Creating changeset...")
-		templateBody, err := apiClient.ReadTemplateFile(TemplateFileName)
+		stack, err := pkg.FindStack(ctx, cfClient, aws.String(StackName))
 		if err != nil {
 			return err
 		}
+		// a REVIEW_IN_PROGRESS stack was never deployed, it accepts only
+		// CREATE changesets
+		newStack = stack == nil || stack.StackStatus == cfTypes.StackStatusReviewInProgress
+		createdStack = stack == nil
+		if stack == nil {
+			PrintfV("Stack %s does not exist, it will be created\n", StackName)
+		} else if newStack {
+			PrintfV("Stack %s is in %s, it will be created\n", StackName, stack.StackStatus)
+		}
+		var sources []pkg.ReconciledParameter
+		parameters, sources, err = changeSetParameters(ctx, cfClient, StackName, newStack, allParameters, parametersOverride, template)
+		if err != nil {
+			return err
+		}
+		if len(sources) > 0 {
+			PrintfV("Parameters:\n")
+			for _, source := range sources {
+				PrintfV("  %s: %s\n", source.Key, source.Source)
+			}
+		}
+		if template != nil {
+			if err := pkg.ValidateParameters(template, parameters); err != nil {
+				return err
+			}
+		}
 
-		changesetArn, err = pkg.CreateChangeSet(cfClient, &StackName, &templateBody, parameters, tags)
+		changeSetConfig, err := changeSetConfigFromFlags(cmd)
 		if err != nil {
+			return err
+		}
+
+		var resourcesToImport []cfTypes.ResourceToImport
+		if ImportFileName != "" {
+			importFileData, err := ioutil.ReadFile(ImportFileName)
+			if err != nil {
+				return err
+			}
+			resourcesToImport, err = pkg.ResourcesToImportFromJson(importFileData)
+			if err != nil {
+				return err
+			}
+		}
+
+		PrintfV("Creating changeset...")
+
+		changeSetOptions := pkg.ChangeSetOptions{
+			ChangeSetConfig: changeSetConfig,
+			ChangeSetName:   aws.String(pkg.NewChangeSetName()),
+			ChangeSetType:   cfTypes.ChangeSetTypeUpdate,
+			StackName:       &StackName,
+			TemplateBody:    &templateBody,
+			Parameters:      parameters,
+			Tags:            tags,
+		}
+		// CloudFormation reads only the templates on S3, the ones downloaded
+		// from other URLs are sent like the local ones
+		if _, _, ok := pkg.ParseS3Url(TemplateFileName, S3Endpoint); ok {
+			templateUrl, err := pkg.TemplateUrl(TemplateFileName, S3Endpoint)
+			if err != nil {
+				PrintfV("\n")
+				return err
+			}
+			changeSetOptions.TemplateURL = &templateUrl
+		} else if S3Bucket != "" {
+			uploadedTemplateKey := pkg.TemplateS3Key(S3Prefix)
+			templateUrl, err := apiClient.UploadTemplate(ctx, S3Bucket, uploadedTemplateKey, templateBody)
+			if err != nil {
+				PrintfV("\n")
+				return err
+			}
+			resources.uploadedTemplateKey = uploadedTemplateKey
+			changeSetOptions.TemplateURL = &templateUrl
+		} else if len(templateBody) > pkg.MaxTemplateBodySize {
 			PrintfV("\n")
+			return fmt.Errorf("the template is bigger than %d bytes, use --s3-bucket to upload it to S3", pkg.MaxTemplateBodySize)
+		}
+		if cmd.Flags().Changed("capabilities") {
+			changeSetOptions.Capabilities = []cfTypes.Capability{}
+			for _, c := range Capabilities {
+				changeSetOptions.Capabilities = append(changeSetOptions.Capabilities, cfTypes.Capability(c))
+			}
+		} else if template != nil {
+			changeSetOptions.Capabilities = pkg.DetectCapabilities(template, func(location string) (string, error) {
+				return apiClient.ReadTemplateFile(ctx, location)
+			})
+		}
+		if newStack {
+			changeSetOptions.ChangeSetType = cfTypes.ChangeSetTypeCreate
+		}
+		if ImportFileName != "" {
+			changeSetOptions.ChangeSetType = cfTypes.ChangeSetTypeImport
+			changeSetOptions.ResourcesToImport = resourcesToImport
+		}
+		changesetArn, err = pkg.CreateChangeSet(ctx, cfClient, changeSetOptions)
+		if err != nil {
+			PrintfV("\n")
+			if ctx.Err() != nil {
+				// the changeset may have been created before the interrupt
+				resources.changeSetName = *changeSetOptions.ChangeSetName
+				resources.createdStack = createdStack
+			}
 			return err
 		}
 		PrintfV("ok\n")
 		if NoDeleteChangeset {
-			cmd.Printf("changeset arn: %s\n", changesetArn)
+			// the changeset keeps its template and its stack
+			resources = temporaryResources{}
+			if Output == outputText {
+				cmd.Printf("changeset arn: %s\n", changesetArn)
+			}
+		} else {
+			resources.changesetArn = changesetArn
+			resources.createdStack = createdStack
 		}
 	}
 
-	describeChangesetOutput, err := pkg.WaitForChangeSet(cfClient, changesetArn, PrintfV)
+	describeChangesetOutput, err := pkg.WaitForChangeSet(ctx, cfClient, changesetArn, pkg.WaitOptions{Timeout: WaitTimeout}, PrintfV)
 	if err != nil {
 		return err
 	}
+	// an empty changeset fails too, it's shown as no changes
+	if err = pkg.ChangeSetError(describeChangesetOutput); err != nil {
+		return err
+	}
 
 	extractedChanges, err := pkg.ExtractChanges(describeChangesetOutput)
 	if err != nil {
 		return err
 	}
+	if err = pkg.FollowNestedChangeSets(ctx, cfClient, extractedChanges); err != nil {
+		return err
+	}
+
+	parameterChanges, err := changeSetParameterChanges(ctx, cfClient, describeChangesetOutput, newStack, parameters, template)
+	if err != nil {
+		return err
+	}
 
-	printChanges(cmd, extractedChanges)
+	if Output == outputJson {
+		cmd.Println(PrettyJson(pkg.NewChangesReport(describeChangesetOutput, extractedChanges, parameterChanges)))
+	} else {
+		printChanges(cmd, extractedChanges)
+		printParameters(cmd, parameterChanges)
+	}
 
 	if Dump {
 		cmd.Println(PrettyJson(describeChangesetOutput))
 	}
 
-	if ChangesetArn != "" {
-		return nil
-	}
+	return nil
+}
+
+// temporaryResources are the resources created by changes, they are
+// registered as soon as they exist and deleted at the end
+type temporaryResources struct {
+	uploadedTemplateKey string
+	changesetArn        string
+	// changeSetName is set when the creation of the changeset is interrupted
+	// and its arn is unknown
+	changeSetName string
+	// createdStack is the REVIEW_IN_PROGRESS stack created by the changeset
+	createdStack bool
+}
 
-	if NoDeleteChangeset {
+// delete deletes the changeset, the template uploaded to S3 and the
+// REVIEW_IN_PROGRESS stack created by the changeset. Every step is attempted,
+// the errors are returned together. It's not cancelled by an interrupt, the
+// time is limited by cleanupTimeout.
+func (r temporaryResources) delete(cmd *cobra.Command, cfClient pkg.CFAPI, apiClient pkg.API) error {
+	if r == (temporaryResources{}) {
 		return nil
 	}
-	PrintfV("Deleting changeset...")
-	err = pkg.DeleteChangeset(cfClient, &changesetArn)
-	if err != nil {
-		return err
+	if commandContext(cmd).Err() != nil {
+		cmd.PrintErrln("Interrupted, deleting the temporary resources")
+	}
+	ctx, cancel := cleanupContext()
+	defer cancel()
+	var errs []string
+	step := func(progress string, what string, delete func() error) {
+		PrintfV("%s...", progress)
+		if err := delete(); err != nil {
+			PrintfV("\n")
+			errs = append(errs, fmt.Sprintf("cannot delete the %s: %v", what, err))
+			return
+		}
+		PrintfV("ok\n")
+	}
+	if r.createdStack {
+		// the changesets are deleted with the stack
+		step("Deleting stack "+StackName, "stack "+StackName, func() error {
+			return pkg.DeleteStack(ctx, cfClient, &StackName)
+		})
+	} else if r.changesetArn != "" {
+		step("Deleting changeset", "changeset", func() error {
+			return pkg.DeleteChangeset(ctx, cfClient, &r.changesetArn)
+		})
+	} else if r.changeSetName != "" {
+		step("Deleting changeset", "changeset", func() error {
+			return pkg.DeleteChangesetByName(ctx, cfClient, &StackName, &r.changeSetName)
+		})
+	}
+	if r.uploadedTemplateKey != "" {
+		step("Deleting uploaded template", "uploaded template", func() error {
+			return apiClient.DeleteTemplate(ctx, S3Bucket, r.uploadedTemplateKey)
+		})
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "\n"))
 	}
-	PrintfV("ok\n")
-
 	return nil
 }
 
@@ -151,7 +437,71 @@ func printChanges(cmd *cobra.Command, changes []pkg.GiffChange) {
 	if len(changes) == 0 {
 		cmd.Println("No changes")
 	}
+	printChangesTree(cmd, changes, "")
+}
+
+// changeSetParameterChanges returns the parameters of the changeset with the
+// previous values of the stack. parameters are the ones used to create the
+// changeset, nil for an existing changeset.
+func changeSetParameterChanges(ctx context.Context, cfClient pkg.CFAPI, out *cf.DescribeChangeSetOutput, newStack bool, parameters []cfTypes.Parameter, template pkg.Template) ([]pkg.GiffParameter, error) {
+	var stackParameters []cfTypes.Parameter
+	stackName := out.StackName
+	if ChangesetArn == "" {
+		stackName = aws.String(StackName)
+	}
+	if !newStack && stackName != nil {
+		var err error
+		stackParameters, err = pkg.GetStackParameters(ctx, cfClient, stackName)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var overridden map[string]bool
+	if ChangesetArn == "" {
+		overridden = map[string]bool{}
+		for _, p := range parameters {
+			if p.ParameterValue != nil && !aws.ToBool(p.UsePreviousValue) {
+				overridden[aws.ToString(p.ParameterKey)] = true
+			}
+		}
+	}
+	return pkg.NewGiffParameters(stackParameters, out.Parameters, overridden, template), nil
+}
+
+// printParameters prints the parameters changed or overridden by the
+// changeset
+func printParameters(cmd *cobra.Command, parameters []pkg.GiffParameter) {
+	header := false
+	for _, p := range parameters {
+		if !p.Changed() && !p.Overridden {
+			continue
+		}
+		if !header {
+			cmd.Println("Parameters:")
+			header = true
+		}
+		switch {
+		case p.PreviousValue == nil:
+			cmd.Printf("+  %s: %s", p.Key, aws.ToString(p.NewValue))
+		case p.NewValue == nil:
+			cmd.Printf("-  %s: %s", p.Key, aws.ToString(p.PreviousValue))
+		case p.Changed():
+			cmd.Printf("*  %s: %s -> %s", p.Key, aws.ToString(p.PreviousValue), aws.ToString(p.NewValue))
+		default:
+			cmd.Printf("   %s: %s", p.Key, aws.ToString(p.NewValue))
+		}
+		if p.Overridden {
+			cmd.Print(" / overridden")
+		}
+		cmd.Println()
+	}
+}
+
+// printChangesTree prints the changes with the given indentation, nested
+// stack changes are printed under their stack resource
+func printChangesTree(cmd *cobra.Command, changes []pkg.GiffChange, indent string) {
 	for _, c := range changes {
+		cmd.Print(indent)
 		switch c.Action {
 		case cfTypes.ChangeActionAdd:
 			cmd.Printf("+     add: %s - %s", *c.LogicalResourceId, *c.ResourceType)
@@ -173,5 +523,137 @@ func printChanges(cmd *cobra.Command, changes []pkg.GiffChange) {
 			}
 		}
 		cmd.Printf("\n")
+		printChangeDetails(cmd, c.Details, indent)
+		printChangesTree(cmd, c.NestedChanges, indent+detailsIndent)
+	}
+}
+
+// detailsIndent aligns the details and the nested changes with the resource logical id
+const detailsIndent = "           "
+
+func printChangeDetails(cmd *cobra.Command, details []pkg.GiffChangeDetail, indent string) {
+	for i, d := range details {
+		branch := "├─"
+		if i == len(details)-1 {
+			branch = "└─"
+		}
+		target := string(d.Attribute)
+		if d.Name != nil {
+			target += "." + *d.Name
+		}
+		cmd.Printf("%s%s%s %s", indent, detailsIndent, branch, target)
+		if d.RequiresRecreation != "" {
+			cmd.Printf(" / recreation: %s", d.RequiresRecreation)
+		}
+		if d.ChangeSource != "" {
+			cmd.Printf(" / source: %s", d.ChangeSource)
+			if d.CausingEntity != nil {
+				cmd.Printf(" (%s)", *d.CausingEntity)
+			}
+		}
+		cmd.Printf("\n")
+	}
+}
+
+// validateCapabilities checks the values of the --capabilities flag
+func validateCapabilities(capabilities []string) error {
+	for _, c := range capabilities {
+		valid := false
+		for _, v := range cfTypes.Capability("").Values() {
+			valid = valid || c == string(v)
+		}
+		if !valid {
+			return fmt.Errorf("invalid capability %q, must be one of %s", c, cfTypes.Capability("").Values())
+		}
+	}
+	return nil
+}
+
+// changeSetConfigFromFlags reads the --changeset-config file, the flags of
+// the single options take precedence
+func changeSetConfigFromFlags(cmd *cobra.Command) (config pkg.ChangeSetConfig, err error) {
+	if ChangeSetConfigFileName != "" {
+		data, err := ioutil.ReadFile(ChangeSetConfigFileName)
+		if err != nil {
+			return config, err
+		}
+		config, err = pkg.ChangeSetConfigFromJson(data)
+		if err != nil {
+			return config, fmt.Errorf("%s: %w", ChangeSetConfigFileName, err)
+		}
+	}
+	flags := cmd.Flags()
+	if flags.Changed("role-arn") {
+		config.RoleARN = aws.String(RoleARN)
+	}
+	if flags.Changed("notification-arns") {
+		config.NotificationARNs = NotificationARNs
+	}
+	if flags.Changed("rollback-configuration") {
+		config.RollbackConfiguration, err = pkg.RollbackConfigurationFromJson([]byte(RollbackConfiguration))
+		if err != nil {
+			return config, err
+		}
+	}
+	if flags.Changed("description") {
+		config.Description = aws.String(ChangeSetDescription)
+	}
+	if flags.Changed("client-token") {
+		config.ClientToken = aws.String(ClientToken)
+	}
+	if flags.Changed("include-nested-stacks") {
+		config.IncludeNestedStacks = aws.Bool(IncludeNestedStacks)
+	}
+	return config, nil
+}
+
+// changeSetParameters returns the parameters of a changeset from the -a and
+// -p flags: all the parameters given with -a, or the stack parameters with
+// the -p overrides. With a parsed template the parameters are reconciled with
+// it and the sources of the values are returned too.
+func changeSetParameters(ctx context.Context, cfClient pkg.CFAPI, stackName string, newStack bool, allParameters []cfTypes.Parameter, parametersOverride []cfTypes.Parameter, template pkg.Template) ([]cfTypes.Parameter, []pkg.ReconciledParameter, error) {
+	if !newStack && (len(parametersOverride) > 0 || len(allParameters) == 0) {
+		stackParameters, err := pkg.GetStackParameters(ctx, cfClient, aws.String(stackName))
+		if err != nil {
+			return nil, nil, err
+		}
+		if template == nil {
+			parameters, err := pkg.OverrideParameters(stackParameters, parametersOverride)
+			return parameters, nil, err
+		}
+		return pkg.ReconcileParameters(template, stackParameters, parametersOverride)
+	}
+	// the template defaults are used for the missing parameters
+	parameters := pkg.MergeParameters(allParameters, parametersOverride)
+	if template == nil {
+		return parameters, nil, nil
+	}
+	return pkg.ReconcileParameters(template, nil, parameters)
+}
+
+// parameterListFromFlag parses the values of a repeatable parameters flag,
+// a parameter given twice keeps the last value
+func parameterListFromFlag(values []string) ([]cfTypes.Parameter, error) {
+	var parameters []cfTypes.Parameter
+	for _, v := range values {
+		p, err := pkg.ParameterListFromString(v)
+		if err != nil {
+			return nil, err
+		}
+		parameters = pkg.MergeParameters(parameters, p)
+	}
+	return parameters, nil
+}
+
+// tagListFromFlag parses the values of a repeatable tags flag
+func tagListFromFlag(values []string) ([]cfTypes.Tag, error) {
+	var tags []cfTypes.Tag
+	for _, v := range values {
+		t, err := pkg.TagListFromString(v)
+		if err != nil {
+			return nil, err
+		}
+		tags = pkg.MergeTags(tags, t)
 	}
+	return tags, nil
 }
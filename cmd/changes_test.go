@@ -2,12 +2,22 @@ package cmd
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	cf "github.com/aws/aws-sdk-go-v2/service/cloudformation"
 	cfTypes "github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
+	"github.com/aws/smithy-go"
+	"github.com/danpizz/giff/pkg"
+	"github.com/spf13/cobra"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -27,34 +37,59 @@ func TestChanges_no_args(t *testing.T) {
 type MockAPI struct {
 }
 
-func (MockAPI) ReadTemplateFile(templateFileName string) (body string, err error) {
+func (MockAPI) ReadTemplateFile(ctx context.Context, templateFileName string) (body string, err error) {
 	return "<template>", nil
 }
 
+// MockAPITemplate reads the template body
+type MockAPITemplate struct {
+	MockAPI
+	body string
+}
+
+func (api MockAPITemplate) ReadTemplateFile(ctx context.Context, templateFileName string) (body string, err error) {
+	return api.body, nil
+}
+
+var MockUploadedTemplate string
+var MockDeletedTemplate string
+
+func (MockAPI) UploadTemplate(ctx context.Context, bucket string, key string, body string) (url string, err error) {
+	MockUploadedTemplate = bucket + "/" + key
+	return "https://" + bucket + ".s3.amazonaws.com/" + key, nil
+}
+func (MockAPI) DeleteTemplate(ctx context.Context, bucket string, key string) error {
+	MockDeletedTemplate = bucket + "/" + key
+	return nil
+}
+
 type MockCFClientNoChanges struct {
 }
 
-func (client MockCFClientNoChanges) CreateChangeSet(params *cf.CreateChangeSetInput) (*cf.CreateChangeSetOutput, error) {
+func (client MockCFClientNoChanges) CreateChangeSet(ctx context.Context, params *cf.CreateChangeSetInput) (*cf.CreateChangeSetOutput, error) {
 	return &cf.CreateChangeSetOutput{
 		Id: aws.String("changesetID"),
 	}, nil
 }
-func (client MockCFClientNoChanges) DescribeStacks(params *cf.DescribeStacksInput) (*cf.DescribeStacksOutput, error) {
+func (client MockCFClientNoChanges) DescribeStacks(ctx context.Context, params *cf.DescribeStacksInput) (*cf.DescribeStacksOutput, error) {
 	return &cf.DescribeStacksOutput{
 		Stacks: []cfTypes.Stack{{Parameters: []cfTypes.Parameter{}}},
 	}, nil
 }
-func (client MockCFClientNoChanges) GetTemplate(params *cf.GetTemplateInput) (*cf.GetTemplateOutput, error) {
+func (client MockCFClientNoChanges) GetTemplate(ctx context.Context, params *cf.GetTemplateInput) (*cf.GetTemplateOutput, error) {
 	return &cf.GetTemplateOutput{}, nil
 }
-func (client MockCFClientNoChanges) DescribeChangeSet(params *cf.DescribeChangeSetInput) (*cf.DescribeChangeSetOutput, error) {
+func (client MockCFClientNoChanges) DescribeChangeSet(ctx context.Context, params *cf.DescribeChangeSetInput) (*cf.DescribeChangeSetOutput, error) {
 	return &cf.DescribeChangeSetOutput{
 		Status: cfTypes.ChangeSetStatusCreateComplete,
 	}, nil
 }
-func (client MockCFClientNoChanges) DeleteChangeSet(params *cf.DeleteChangeSetInput) (*cf.DeleteChangeSetOutput, error) {
+func (client MockCFClientNoChanges) DeleteChangeSet(ctx context.Context, params *cf.DeleteChangeSetInput) (*cf.DeleteChangeSetOutput, error) {
 	return &cf.DeleteChangeSetOutput{}, nil
 }
+func (client MockCFClientNoChanges) DeleteStack(ctx context.Context, params *cf.DeleteStackInput) (*cf.DeleteStackOutput, error) {
+	return &cf.DeleteStackOutput{}, nil
+}
 
 func TestChanges_no_changes(t *testing.T) {
 	cmd := NewChangesCmd(MockCFClientNoChanges{}, MockAPI{})
@@ -74,20 +109,20 @@ type MockCFClientChanges struct {
 
 var MockAction cfTypes.ChangeAction
 
-func (client MockCFClientChanges) CreateChangeSet(params *cf.CreateChangeSetInput) (*cf.CreateChangeSetOutput, error) {
+func (client MockCFClientChanges) CreateChangeSet(ctx context.Context, params *cf.CreateChangeSetInput) (*cf.CreateChangeSetOutput, error) {
 	return &cf.CreateChangeSetOutput{
 		Id: aws.String(""),
 	}, nil
 }
-func (client MockCFClientChanges) DescribeStacks(params *cf.DescribeStacksInput) (*cf.DescribeStacksOutput, error) {
+func (client MockCFClientChanges) DescribeStacks(ctx context.Context, params *cf.DescribeStacksInput) (*cf.DescribeStacksOutput, error) {
 	return &cf.DescribeStacksOutput{
 		Stacks: []cfTypes.Stack{{Parameters: []cfTypes.Parameter{}}},
 	}, nil
 }
-func (client MockCFClientChanges) GetTemplate(params *cf.GetTemplateInput) (*cf.GetTemplateOutput, error) {
+func (client MockCFClientChanges) GetTemplate(ctx context.Context, params *cf.GetTemplateInput) (*cf.GetTemplateOutput, error) {
 	return &cf.GetTemplateOutput{}, nil
 }
-func (client MockCFClientChanges) DescribeChangeSet(params *cf.DescribeChangeSetInput) (*cf.DescribeChangeSetOutput, error) {
+func (client MockCFClientChanges) DescribeChangeSet(ctx context.Context, params *cf.DescribeChangeSetInput) (*cf.DescribeChangeSetOutput, error) {
 	return &cf.DescribeChangeSetOutput{
 		Status: cfTypes.ChangeSetStatusCreateComplete,
 		Changes: []cfTypes.Change{
@@ -99,15 +134,36 @@ func (client MockCFClientChanges) DescribeChangeSet(params *cf.DescribeChangeSet
 					Replacement:        cfTypes.ReplacementTrue,
 					ResourceType:       aws.String("RT"),
 					Scope:              []cfTypes.ResourceAttribute{},
+					Details: []cfTypes.ResourceChangeDetail{
+						{
+							ChangeSource: cfTypes.ChangeSourceDirectModification,
+							Target: &cfTypes.ResourceTargetDefinition{
+								Attribute:          cfTypes.ResourceAttributeProperties,
+								Name:               aws.String("KeyName"),
+								RequiresRecreation: cfTypes.RequiresRecreationAlways,
+							},
+						},
+						{
+							ChangeSource:  cfTypes.ChangeSourceParameterReference,
+							CausingEntity: aws.String("Purpose"),
+							Target: &cfTypes.ResourceTargetDefinition{
+								Attribute:          cfTypes.ResourceAttributeTags,
+								RequiresRecreation: cfTypes.RequiresRecreationNever,
+							},
+						},
+					},
 				},
 				Type: cfTypes.ChangeTypeResource,
 			},
 		},
 	}, nil
 }
-func (client MockCFClientChanges) DeleteChangeSet(params *cf.DeleteChangeSetInput) (*cf.DeleteChangeSetOutput, error) {
+func (client MockCFClientChanges) DeleteChangeSet(ctx context.Context, params *cf.DeleteChangeSetInput) (*cf.DeleteChangeSetOutput, error) {
 	return &cf.DeleteChangeSetOutput{}, nil
 }
+func (client MockCFClientChanges) DeleteStack(ctx context.Context, params *cf.DeleteStackInput) (*cf.DeleteStackOutput, error) {
+	return &cf.DeleteStackOutput{}, nil
+}
 
 func TestChanges_all(t *testing.T) {
 	cmd := NewChangesCmd(MockCFClientChanges{}, MockAPI{})
@@ -142,6 +198,18 @@ func TestChanges_all(t *testing.T) {
 		}
 		assert.Contains(t, string(out), "*  modify: LogRId (PhyRId) - RT / replacement: True")
 	})
+	t.Run("details", func(t *testing.T) {
+		MockAction = cfTypes.ChangeActionModify
+		cmd.Execute()
+		out, err := ioutil.ReadAll(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Contains(t, string(out),
+			"*  modify: LogRId (PhyRId) - RT / replacement: True\n"+
+				"           ├─ Properties.KeyName / recreation: Always / source: DirectModification\n"+
+				"           └─ Tags / recreation: Never / source: ParameterReference (Purpose)\n")
+	})
 	t.Run("dynamic", func(t *testing.T) {
 		MockAction = cfTypes.ChangeActionDynamic
 		cmd.Execute()
@@ -171,3 +239,776 @@ func TestChanges_all(t *testing.T) {
 	})
 
 }
+
+func TestChanges_json(t *testing.T) {
+	cmd := NewChangesCmd(MockCFClientChanges{}, MockAPI{})
+	cmd.SetArgs([]string{"stack", "template", "-p", "p1=v1", "-o", "json"})
+	b := bytes.NewBufferString("")
+	cmd.SetOutput(b)
+	MockAction = cfTypes.ChangeActionAdd
+	cmd.Execute()
+	out, err := ioutil.ReadAll(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report pkg.ChangesReport
+	if err := json.Unmarshal(out, &report); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, pkg.ChangesReportSchemaVersion, report.SchemaVersion)
+	assert.Exactly(t,
+		[]pkg.GiffChange{
+			{
+				Action:             cfTypes.ChangeActionAdd,
+				LogicalResourceId:  aws.String("LogRId"),
+				PhysicalResourceId: aws.String("PhyRId"),
+				Replacement:        cfTypes.ReplacementTrue,
+				ResourceType:       aws.String("RT"),
+				Scope:              []cfTypes.ResourceAttribute{},
+				Details: []pkg.GiffChangeDetail{
+					{
+						Attribute:          cfTypes.ResourceAttributeProperties,
+						Name:               aws.String("KeyName"),
+						RequiresRecreation: cfTypes.RequiresRecreationAlways,
+						ChangeSource:       cfTypes.ChangeSourceDirectModification,
+					},
+					{
+						Attribute:          cfTypes.ResourceAttributeTags,
+						RequiresRecreation: cfTypes.RequiresRecreationNever,
+						ChangeSource:       cfTypes.ChangeSourceParameterReference,
+						CausingEntity:      aws.String("Purpose"),
+					},
+				},
+			},
+		},
+		report.Changes)
+}
+
+func TestChanges_json_verbose(t *testing.T) {
+	cmd := NewChangesCmd(MockCFClientChanges{}, MockAPI{})
+	cmd.SetArgs([]string{"stack", "template", "-p", "p1=v1", "-o", "json"})
+	stdout := bytes.NewBufferString("")
+	stderr := bytes.NewBufferString("")
+	cmd.SetOut(stdout)
+	cmd.SetErr(stderr)
+	rootCmd.SetErr(stderr)
+	defer rootCmd.SetErr(nil)
+	verbose = true
+	defer func() { verbose = false }()
+	cmd.Execute()
+	var report pkg.ChangesReport
+	assert.NoError(t, json.Unmarshal(stdout.Bytes(), &report), stdout.String())
+	assert.Contains(t, stderr.String(), "Creating changeset...ok\n")
+}
+
+func TestChanges_json_and_dump(t *testing.T) {
+	cmd := NewChangesCmd(MockCFClientChanges{}, MockAPI{})
+	cmd.SetArgs([]string{"stack", "template", "-o", "json", "--dump"})
+	b := bytes.NewBufferString("")
+	cmd.SetOutput(b)
+	cmd.Execute()
+	out, err := ioutil.ReadAll(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, string(out), "Error: --dump cannot be used with --output json")
+}
+
+type MockCFClientNested struct {
+	MockCFClientNoChanges
+}
+
+func (client MockCFClientNested) DescribeChangeSet(ctx context.Context, params *cf.DescribeChangeSetInput) (*cf.DescribeChangeSetOutput, error) {
+	stackChange := func(logicalId string, changeSetId string) cfTypes.Change {
+		return cfTypes.Change{
+			ResourceChange: &cfTypes.ResourceChange{
+				Action:             cfTypes.ChangeActionModify,
+				ChangeSetId:        aws.String(changeSetId),
+				LogicalResourceId:  aws.String(logicalId),
+				PhysicalResourceId: aws.String(logicalId + "-stack"),
+				Replacement:        cfTypes.ReplacementFalse,
+				ResourceType:       aws.String("AWS::CloudFormation::Stack"),
+			},
+			Type: cfTypes.ChangeTypeResource,
+		}
+	}
+	out := &cf.DescribeChangeSetOutput{Status: cfTypes.ChangeSetStatusCreateComplete}
+	switch *params.ChangeSetName {
+	case "changesetID":
+		out.Changes = []cfTypes.Change{stackChange("Network", "network-changeset")}
+	case "network-changeset":
+		out.Changes = []cfTypes.Change{
+			stackChange("Subnets", "subnets-changeset"),
+			{
+				ResourceChange: &cfTypes.ResourceChange{
+					Action:            cfTypes.ChangeActionAdd,
+					LogicalResourceId: aws.String("Vpc"),
+					ResourceType:      aws.String("AWS::EC2::VPC"),
+				},
+				Type: cfTypes.ChangeTypeResource,
+			},
+		}
+	case "subnets-changeset":
+		out.Changes = []cfTypes.Change{
+			{
+				ResourceChange: &cfTypes.ResourceChange{
+					Action:             cfTypes.ChangeActionRemove,
+					LogicalResourceId:  aws.String("Subnet"),
+					PhysicalResourceId: aws.String("subnet-1"),
+					ResourceType:       aws.String("AWS::EC2::Subnet"),
+				},
+				Type: cfTypes.ChangeTypeResource,
+			},
+		}
+	}
+	return out, nil
+}
+
+func TestChanges_nested(t *testing.T) {
+	cmd := NewChangesCmd(MockCFClientNested{}, MockAPI{})
+	cmd.SetArgs([]string{"stack", "template"})
+	b := bytes.NewBufferString("")
+	cmd.SetOutput(b)
+	cmd.Execute()
+	out, err := ioutil.ReadAll(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Exactly(t,
+		"*  modify: Network (Network-stack) - AWS::CloudFormation::Stack / replacement: False\n"+
+			"           *  modify: Subnets (Subnets-stack) - AWS::CloudFormation::Stack / replacement: False\n"+
+			"                      -  remove: Subnet - AWS::EC2::Subnet\n"+
+			"           +     add: Vpc - AWS::EC2::VPC\n",
+		string(out))
+}
+
+// MockCFClientNewStack records the calls made for a stack that does not exist
+type MockCFClientNewStack struct {
+	MockCFClientChanges
+	createChangeSetInput *cf.CreateChangeSetInput
+	deletedStack         *string
+}
+
+func (client *MockCFClientNewStack) DescribeStacks(ctx context.Context, params *cf.DescribeStacksInput) (*cf.DescribeStacksOutput, error) {
+	return nil, &smithy.GenericAPIError{
+		Code:    "ValidationError",
+		Message: "Stack with id " + *params.StackName + " does not exist",
+	}
+}
+func (client *MockCFClientNewStack) CreateChangeSet(ctx context.Context, params *cf.CreateChangeSetInput) (*cf.CreateChangeSetOutput, error) {
+	client.createChangeSetInput = params
+	return &cf.CreateChangeSetOutput{
+		Id: aws.String("changesetID"),
+	}, nil
+}
+func (client *MockCFClientNewStack) DeleteStack(ctx context.Context, params *cf.DeleteStackInput) (*cf.DeleteStackOutput, error) {
+	client.deletedStack = params.StackName
+	return &cf.DeleteStackOutput{}, nil
+}
+
+func TestChanges_new_stack(t *testing.T) {
+	client := &MockCFClientNewStack{}
+	cmd := NewChangesCmd(client, MockAPI{})
+	cmd.SetArgs([]string{"new-stack", "template", "-p", "p1=v1"})
+	b := bytes.NewBufferString("")
+	cmd.SetOutput(b)
+	MockAction = cfTypes.ChangeActionAdd
+	cmd.Execute()
+	out, err := ioutil.ReadAll(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, string(out), "+     add: LogRId - RT")
+	assert.Equal(t, cfTypes.ChangeSetTypeCreate, client.createChangeSetInput.ChangeSetType)
+	assert.Exactly(t,
+		[]cfTypes.Parameter{
+			{
+				ParameterKey:   aws.String("p1"),
+				ParameterValue: aws.String("v1"),
+			},
+		},
+		client.createChangeSetInput.Parameters)
+	assert.Equal(t, aws.String("new-stack"), client.deletedStack)
+}
+
+// MockCFClientReviewInProgress is a stack left in REVIEW_IN_PROGRESS by a
+// previous changeset
+type MockCFClientReviewInProgress struct {
+	MockCFClientNewStack
+	deletedChangeSet *string
+}
+
+func (client *MockCFClientReviewInProgress) DescribeStacks(ctx context.Context, params *cf.DescribeStacksInput) (*cf.DescribeStacksOutput, error) {
+	return &cf.DescribeStacksOutput{
+		Stacks: []cfTypes.Stack{{StackName: params.StackName, StackStatus: cfTypes.StackStatusReviewInProgress}},
+	}, nil
+}
+func (client *MockCFClientReviewInProgress) DeleteChangeSet(ctx context.Context, params *cf.DeleteChangeSetInput) (*cf.DeleteChangeSetOutput, error) {
+	client.deletedChangeSet = params.ChangeSetName
+	return &cf.DeleteChangeSetOutput{}, nil
+}
+
+func TestChanges_review_in_progress(t *testing.T) {
+	client := &MockCFClientReviewInProgress{}
+	cmd := NewChangesCmd(client, MockAPI{})
+	cmd.SetArgs([]string{"new-stack", "template", "-p", "p1=v1"})
+	cmd.SetOutput(bytes.NewBufferString(""))
+	cmd.Execute()
+	assert.Equal(t, cfTypes.ChangeSetTypeCreate, client.createChangeSetInput.ChangeSetType)
+	assert.Equal(t, aws.String("changesetID"), client.deletedChangeSet)
+	// the stack was not created by this run
+	assert.Nil(t, client.deletedStack)
+}
+
+// MockCFClientRecorder records the input of the created changeset
+type MockCFClientRecorder struct {
+	MockCFClientChanges
+	createChangeSetInput *cf.CreateChangeSetInput
+}
+
+func (client *MockCFClientRecorder) CreateChangeSet(ctx context.Context, params *cf.CreateChangeSetInput) (*cf.CreateChangeSetOutput, error) {
+	client.createChangeSetInput = params
+	return &cf.CreateChangeSetOutput{
+		Id: aws.String("changesetID"),
+	}, nil
+}
+
+func TestChanges_import(t *testing.T) {
+	importFile, err := ioutil.TempFile("", "giff-import")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(importFile.Name())
+	importFile.WriteString(`[{"ResourceType":"RT","LogicalResourceId":"LogRId","ResourceIdentifier":{"BucketName":"PhyRId"}}]`)
+	importFile.Close()
+
+	client := &MockCFClientRecorder{}
+	cmd := NewChangesCmd(client, MockAPI{})
+	cmd.SetArgs([]string{"stack", "template", "--import", importFile.Name()})
+	b := bytes.NewBufferString("")
+	cmd.SetOutput(b)
+	MockAction = cfTypes.ChangeActionImport
+	cmd.Execute()
+	out, err := ioutil.ReadAll(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, string(out), "+  import: LogRId (PhyRId) - RT")
+	assert.Equal(t, cfTypes.ChangeSetTypeImport, client.createChangeSetInput.ChangeSetType)
+	assert.Exactly(t,
+		[]cfTypes.ResourceToImport{
+			{
+				LogicalResourceId:  aws.String("LogRId"),
+				ResourceIdentifier: map[string]string{"BucketName": "PhyRId"},
+				ResourceType:       aws.String("RT"),
+			},
+		},
+		client.createChangeSetInput.ResourcesToImport)
+}
+
+// bigTemplate must be uploaded to S3
+var bigTemplate = strings.Repeat("#", pkg.MaxTemplateBodySize+1)
+
+func TestChanges_s3_bucket(t *testing.T) {
+	api := MockAPITemplate{body: bigTemplate}
+	client := &MockCFClientRecorder{}
+	cmd := NewChangesCmd(client, api)
+	cmd.SetArgs([]string{"stack", "template", "--s3-bucket", "bucket", "--s3-prefix", "templates/"})
+	b := bytes.NewBufferString("")
+	cmd.SetOutput(b)
+	cmd.Execute()
+	assert.Regexp(t, `^bucket/templates/giff-\w+\.template$`, MockUploadedTemplate)
+	key := strings.TrimPrefix(MockUploadedTemplate, "bucket/")
+	assert.Equal(t, "bucket/"+key, MockDeletedTemplate)
+	assert.Equal(t, aws.String("https://bucket.s3.amazonaws.com/"+key), client.createChangeSetInput.TemplateURL)
+	assert.Nil(t, client.createChangeSetInput.TemplateBody)
+}
+
+func TestChanges_template_too_big(t *testing.T) {
+	api := MockAPITemplate{body: bigTemplate}
+	cmd := NewChangesCmd(&MockCFClientRecorder{}, api)
+	cmd.SetOutput(bytes.NewBufferString(""))
+	if err := cmd.Args(cmd, []string{"stack", "template"}); err != nil {
+		t.Fatal(err)
+	}
+	err := changes(cmd, &MockCFClientRecorder{}, api)
+	assert.EqualError(t, err, "the template is bigger than 51200 bytes, use --s3-bucket to upload it to S3")
+}
+
+func TestChanges_template_url(t *testing.T) {
+	client := &MockCFClientRecorder{}
+	cmd := NewChangesCmd(client, MockAPI{})
+	cmd.SetArgs([]string{"stack", "s3://bucket/templates/template.yaml"})
+	b := bytes.NewBufferString("")
+	cmd.SetOutput(b)
+	cmd.Execute()
+	assert.Equal(t, aws.String("https://bucket.s3.amazonaws.com/templates/template.yaml"), client.createChangeSetInput.TemplateURL)
+
+	// CloudFormation doesn't read the other URLs, the downloaded template is sent
+	client = &MockCFClientRecorder{}
+	cmd = NewChangesCmd(client, MockAPI{})
+	cmd.SetArgs([]string{"stack", "https://example.com/template.yaml"})
+	cmd.SetOutput(bytes.NewBufferString(""))
+	cmd.Execute()
+	assert.Nil(t, client.createChangeSetInput.TemplateURL)
+	assert.Equal(t, aws.String("<template>"), client.createChangeSetInput.TemplateBody)
+
+	MockUploadedTemplate = ""
+	client = &MockCFClientRecorder{}
+	cmd = NewChangesCmd(client, MockAPITemplate{body: bigTemplate})
+	cmd.SetArgs([]string{"stack", "https://example.com/template.yaml", "--s3-bucket", "bucket", "--s3-prefix", ""})
+	cmd.SetOutput(bytes.NewBufferString(""))
+	cmd.Execute()
+	assert.Regexp(t, `^bucket/giff-\w+\.template$`, MockUploadedTemplate)
+	assert.Equal(t, aws.String("https://"+strings.Replace(MockUploadedTemplate, "/", ".s3.amazonaws.com/", 1)), client.createChangeSetInput.TemplateURL)
+}
+
+func TestChanges_parameters_file(t *testing.T) {
+	dir := t.TempDir()
+	parametersFile := filepath.Join(dir, "parameters.json")
+	tagsFile := filepath.Join(dir, "tags.txt")
+	ioutil.WriteFile(parametersFile, []byte(`{"Parameters": {"p1": "file", "p2": "file"}, "Tags": {"ignored": "x"}}`), 0600)
+	ioutil.WriteFile(tagsFile, []byte("t1=file\nt2=file\n"), 0600)
+
+	client := &MockCFClientNewStack{}
+	cmd := NewChangesCmd(client, MockAPI{})
+	cmd.SetArgs([]string{"new-stack", "template", "--parameters-file", parametersFile, "-p", "p2=cli", "--tags-file", tagsFile, "-t", "t2=cli"})
+	cmd.SetOutput(bytes.NewBufferString(""))
+	cmd.Execute()
+	assert.Exactly(t,
+		[]cfTypes.Parameter{
+			{ParameterKey: aws.String("p1"), ParameterValue: aws.String("file")},
+			{ParameterKey: aws.String("p2"), ParameterValue: aws.String("cli")},
+		},
+		client.createChangeSetInput.Parameters)
+	assert.Exactly(t,
+		[]cfTypes.Tag{
+			{Key: aws.String("t1"), Value: aws.String("file")},
+			{Key: aws.String("t2"), Value: aws.String("cli")},
+		},
+		client.createChangeSetInput.Tags)
+}
+
+func TestChanges_repeated_parameters(t *testing.T) {
+	client := &MockCFClientNewStack{}
+	cmd := NewChangesCmd(client, MockAPI{})
+	cmd.SetArgs([]string{"new-stack", "template", "-p", "Filter=a=b", "-p", `Name="a b" Size=1`, "-t", "team=ops", "-t", "cost='a b'"})
+	cmd.SetOutput(bytes.NewBufferString(""))
+	cmd.Execute()
+	assert.Exactly(t,
+		[]cfTypes.Parameter{
+			{ParameterKey: aws.String("Filter"), ParameterValue: aws.String("a=b")},
+			{ParameterKey: aws.String("Name"), ParameterValue: aws.String("a b")},
+			{ParameterKey: aws.String("Size"), ParameterValue: aws.String("1")},
+		},
+		client.createChangeSetInput.Parameters)
+	assert.Exactly(t,
+		[]cfTypes.Tag{
+			{Key: aws.String("team"), Value: aws.String("ops")},
+			{Key: aws.String("cost"), Value: aws.String("a b")},
+		},
+		client.createChangeSetInput.Tags)
+}
+
+func TestChanges_malformed_parameters(t *testing.T) {
+	cmd := NewChangesCmd(&MockCFClientNewStack{}, MockAPI{})
+	cmd.SetOutput(bytes.NewBufferString(""))
+	if err := cmd.ParseFlags([]string{"-p", "Size"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Args(cmd, []string{"stack", "template"}); err != nil {
+		t.Fatal(err)
+	}
+	err := changes(cmd, &MockCFClientNewStack{}, MockAPI{})
+	assert.EqualError(t, err, "invalid parameters: expected Key=Value, found \"Size\"")
+}
+
+func TestChanges_invalid_parameters(t *testing.T) {
+	api := MockAPITemplate{body: "Parameters:\n  Size:\n    Type: String\n    AllowedValues: [small, large]\n    ConstraintDescription: small or large\nResources: {}\n"}
+	client := &MockCFClientNewStack{}
+	cmd := NewChangesCmd(client, api)
+	cmd.SetOutput(bytes.NewBufferString(""))
+	if err := cmd.ParseFlags([]string{"-p", "Size=medium Sise=large"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Args(cmd, []string{"stack", "template"}); err != nil {
+		t.Fatal(err)
+	}
+	err := changes(cmd, client, api)
+	assert.EqualError(t, err,
+		"invalid parameters:\n"+
+			"  Sise: not a parameter of the template\n"+
+			"  Size: value \"medium\" is not one of the AllowedValues small, large (small or large)")
+	assert.Nil(t, client.createChangeSetInput)
+}
+
+type MockCFClientReconcile struct {
+	MockCFClientRecorder
+}
+
+func (client *MockCFClientReconcile) DescribeStacks(ctx context.Context, params *cf.DescribeStacksInput) (*cf.DescribeStacksOutput, error) {
+	return &cf.DescribeStacksOutput{
+		Stacks: []cfTypes.Stack{{Parameters: []cfTypes.Parameter{
+			{ParameterKey: aws.String("Env"), ParameterValue: aws.String("prod")},
+			{ParameterKey: aws.String("Size"), ParameterValue: aws.String("1")},
+			{ParameterKey: aws.String("Removed"), ParameterValue: aws.String("y")},
+		}}},
+	}, nil
+}
+
+func TestChanges_reconcile_parameters(t *testing.T) {
+	api := MockAPITemplate{body: "Parameters:\n  Env: {Type: String}\n  Size: {Type: Number}\n  Added: {Type: String, Default: x}\nResources: {}\n"}
+	client := &MockCFClientReconcile{}
+	cmd := NewChangesCmd(client, api)
+	cmd.SetArgs([]string{"stack", "template", "-p", "Size=2"})
+	b := bytes.NewBufferString("")
+	cmd.SetOutput(b)
+	rootCmd.SetErr(b)
+	defer rootCmd.SetErr(nil)
+	verbose = true
+	defer func() { verbose = false }()
+	cmd.Execute()
+	assert.Exactly(t,
+		[]cfTypes.Parameter{
+			{ParameterKey: aws.String("Env"), UsePreviousValue: aws.Bool(true)},
+			{ParameterKey: aws.String("Size"), ParameterValue: aws.String("2"), UsePreviousValue: aws.Bool(false)},
+		},
+		client.createChangeSetInput.Parameters)
+	assert.Contains(t, b.String(),
+		"Parameters:\n"+
+			"  Added: defaulted\n"+
+			"  Env: inherited\n"+
+			"  Size: overridden\n")
+}
+
+type MockCFClientParameterChanges struct {
+	MockCFClientNoChanges
+}
+
+func (client MockCFClientParameterChanges) DescribeStacks(ctx context.Context, params *cf.DescribeStacksInput) (*cf.DescribeStacksOutput, error) {
+	return &cf.DescribeStacksOutput{
+		Stacks: []cfTypes.Stack{{Parameters: []cfTypes.Parameter{
+			{ParameterKey: aws.String("Env"), ParameterValue: aws.String("prod")},
+			{ParameterKey: aws.String("Size"), ParameterValue: aws.String("1")},
+			{ParameterKey: aws.String("Password"), ParameterValue: aws.String("****")},
+			{ParameterKey: aws.String("Old"), ParameterValue: aws.String("x")},
+		}}},
+	}, nil
+}
+
+func (client MockCFClientParameterChanges) DescribeChangeSet(ctx context.Context, params *cf.DescribeChangeSetInput) (*cf.DescribeChangeSetOutput, error) {
+	return &cf.DescribeChangeSetOutput{
+		Status: cfTypes.ChangeSetStatusCreateComplete,
+		Parameters: []cfTypes.Parameter{
+			{ParameterKey: aws.String("Env"), ParameterValue: aws.String("prod")},
+			{ParameterKey: aws.String("Size"), ParameterValue: aws.String("2")},
+			{ParameterKey: aws.String("Password"), ParameterValue: aws.String("****")},
+		},
+	}, nil
+}
+
+func TestChanges_parameters(t *testing.T) {
+	api := MockAPITemplate{body: "Parameters:\n  Env: {Type: String}\n  Size: {Type: Number}\n  Password: {Type: String, NoEcho: true}\nResources: {}\n"}
+	cmd := NewChangesCmd(MockCFClientParameterChanges{}, api)
+	cmd.SetArgs([]string{"stack", "template", "-p", "Size=2 Password=secret"})
+	b := bytes.NewBufferString("")
+	cmd.SetOutput(b)
+	cmd.Execute()
+	assert.Equal(t,
+		"No changes\n"+
+			"Parameters:\n"+
+			"-  Old: x\n"+
+			"   Password: **** / overridden\n"+
+			"*  Size: 1 -> 2 / overridden\n",
+		b.String())
+
+	cmd = NewChangesCmd(MockCFClientParameterChanges{}, api)
+	cmd.SetArgs([]string{"stack", "template", "-p", "Size=2 Password=secret", "-o", "json"})
+	b = bytes.NewBufferString("")
+	cmd.SetOutput(b)
+	cmd.Execute()
+	var report pkg.ChangesReport
+	if err := json.Unmarshal(b.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	assert.Exactly(t,
+		[]pkg.GiffParameter{
+			{Key: "Env", PreviousValue: aws.String("prod"), NewValue: aws.String("prod")},
+			{Key: "Old", PreviousValue: aws.String("x")},
+			{Key: "Password", PreviousValue: aws.String("****"), NewValue: aws.String("****"), Overridden: true},
+			{Key: "Size", PreviousValue: aws.String("1"), NewValue: aws.String("2"), Overridden: true},
+		},
+		report.Parameters)
+}
+
+func TestChanges_capabilities(t *testing.T) {
+	api := MockAPITemplate{body: "Transform: AWS::Serverless-2016-10-31\nResources:\n  Role: {Type: AWS::IAM::Role}\n"}
+	client := &MockCFClientRecorder{}
+	cmd := NewChangesCmd(client, api)
+	cmd.SetArgs([]string{"stack", "template"})
+	cmd.SetOutput(bytes.NewBufferString(""))
+	cmd.Execute()
+	assert.Equal(t,
+		[]cfTypes.Capability{cfTypes.CapabilityCapabilityIam, cfTypes.CapabilityCapabilityAutoExpand},
+		client.createChangeSetInput.Capabilities)
+
+	client = &MockCFClientRecorder{}
+	cmd = NewChangesCmd(client, api)
+	cmd.SetArgs([]string{"stack", "template", "--capabilities", "CAPABILITY_NAMED_IAM"})
+	cmd.SetOutput(bytes.NewBufferString(""))
+	cmd.Execute()
+	assert.Equal(t, []cfTypes.Capability{cfTypes.CapabilityCapabilityNamedIam}, client.createChangeSetInput.Capabilities)
+
+	cmd = NewChangesCmd(client, api)
+	cmd.SetArgs([]string{"stack", "template", "--capabilities", "CAPABILITY_ALL"})
+	b := bytes.NewBufferString("")
+	cmd.SetOutput(b)
+	cmd.Execute()
+	assert.Contains(t, b.String(), "Error: invalid capability \"CAPABILITY_ALL\", must be one of [CAPABILITY_IAM CAPABILITY_NAMED_IAM CAPABILITY_AUTO_EXPAND]")
+}
+
+func TestChanges_changeset_config(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "changeset.json")
+	ioutil.WriteFile(configFile, []byte(`{
+		"RoleARN": "file-role",
+		"NotificationARNs": ["file-topic"],
+		"Description": "file description",
+		"IncludeNestedStacks": false
+	}`), 0600)
+
+	client := &MockCFClientRecorder{}
+	cmd := NewChangesCmd(client, MockAPI{})
+	cmd.SetArgs([]string{"stack", "template", "--changeset-config", configFile, "--role-arn", "cli-role",
+		"--rollback-configuration", `{"RollbackTriggers":[{"Arn":"alarm","Type":"AWS::CloudWatch::Alarm"}],"MonitoringTimeInMinutes":10}`,
+		"--client-token", "token"})
+	cmd.SetOutput(bytes.NewBufferString(""))
+	cmd.Execute()
+	input := client.createChangeSetInput
+	assert.Equal(t, aws.String("cli-role"), input.RoleARN)
+	assert.Equal(t, []string{"file-topic"}, input.NotificationARNs)
+	assert.Equal(t, aws.String("file description"), input.Description)
+	assert.Equal(t, aws.String("token"), input.ClientToken)
+	assert.Equal(t, aws.Bool(false), input.IncludeNestedStacks)
+	assert.Equal(t,
+		&cfTypes.RollbackConfiguration{
+			RollbackTriggers:        []cfTypes.RollbackTrigger{{Arn: aws.String("alarm"), Type: aws.String("AWS::CloudWatch::Alarm")}},
+			MonitoringTimeInMinutes: aws.Int32(10),
+		},
+		input.RollbackConfiguration)
+
+	client = &MockCFClientRecorder{}
+	cmd = NewChangesCmd(client, MockAPI{})
+	cmd.SetArgs([]string{"stack", "template"})
+	cmd.SetOutput(bytes.NewBufferString(""))
+	cmd.Execute()
+	input = client.createChangeSetInput
+	assert.Nil(t, input.RoleARN)
+	assert.Nil(t, input.RollbackConfiguration)
+	assert.Equal(t, aws.Bool(true), input.IncludeNestedStacks)
+
+	cmd = NewChangesCmd(client, MockAPI{})
+	cmd.SetArgs([]string{"arn:aws:cloudformation:us-east-1:123456789012:changeSet/name/id", "--role-arn", "role"})
+	b := bytes.NewBufferString("")
+	cmd.SetOutput(b)
+	cmd.Execute()
+	assert.Contains(t, b.String(), "Error: unaccepted flag --role-arn with a changeset arn")
+}
+
+func TestChanges_arn_flags(t *testing.T) {
+	arn := "arn:aws:cloudformation:us-east-1:123456789012:changeSet/name/id"
+	for _, flags := range [][]string{
+		{"--tags", "team=a"},
+		{"--s3-prefix", "templates"},
+		{"--s3-endpoint", "http://localhost:4566"},
+	} {
+		cmd := NewChangesCmd(nil, nil)
+		if err := cmd.ParseFlags(flags); err != nil {
+			t.Fatal(err)
+		}
+		assert.EqualError(t, cmd.Args(cmd, []string{arn}), "unaccepted flag "+flags[0]+" with a changeset arn")
+	}
+}
+
+// MockCFClientInterrupted never completes the changeset and records the
+// deleted changeset
+type MockCFClientInterrupted struct {
+	MockCFClientNoChanges
+	deletedChangeSet *string
+	deleteCtxErr     error
+}
+
+func (client *MockCFClientInterrupted) DescribeChangeSet(ctx context.Context, params *cf.DescribeChangeSetInput) (*cf.DescribeChangeSetOutput, error) {
+	return &cf.DescribeChangeSetOutput{Status: cfTypes.ChangeSetStatusCreatePending}, nil
+}
+func (client *MockCFClientInterrupted) DeleteChangeSet(ctx context.Context, params *cf.DeleteChangeSetInput) (*cf.DeleteChangeSetOutput, error) {
+	client.deletedChangeSet = params.ChangeSetName
+	client.deleteCtxErr = ctx.Err()
+	return &cf.DeleteChangeSetOutput{}, nil
+}
+
+func TestChanges_interrupted(t *testing.T) {
+	client := &MockCFClientInterrupted{}
+	cmd := NewChangesCmd(client, MockAPI{})
+	cmd.SetArgs([]string{"stack", "template"})
+	b := bytes.NewBufferString("")
+	cmd.SetOutput(b)
+	// ExecuteContext sets the context and the args, changes is called after
+	// it to read the error
+	cmd.Run = func(*cobra.Command, []string) {}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := cmd.ExecuteContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+	err := changes(cmd, client, MockAPI{})
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, aws.String("changesetID"), client.deletedChangeSet)
+	assert.NoError(t, client.deleteCtxErr)
+	assert.Contains(t, b.String(), "Interrupted, deleting the temporary resources")
+}
+
+func TestChanges_wait_timeout(t *testing.T) {
+	cmd := NewChangesCmd(nil, nil)
+	if err := cmd.ParseFlags([]string{"--wait-timeout", "0s"}); err != nil {
+		t.Fatal(err)
+	}
+	assert.EqualError(t, cmd.Args(cmd, []string{"stack", "template"}), "--wait-timeout must be positive")
+
+	cmd = NewChangesCmd(nil, nil)
+	if err := cmd.ParseFlags([]string{"--wait-timeout", "30m"}); err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, cmd.Args(cmd, []string{"stack", "template"}))
+	assert.Equal(t, 30*time.Minute, WaitTimeout)
+}
+
+// MockCFClientFailed returns a FAILED changeset with the given reason and
+// records the deleted changeset
+type MockCFClientFailed struct {
+	MockCFClientNoChanges
+	statusReason     string
+	deletedChangeSet *string
+}
+
+func (client *MockCFClientFailed) DescribeChangeSet(ctx context.Context, params *cf.DescribeChangeSetInput) (*cf.DescribeChangeSetOutput, error) {
+	return &cf.DescribeChangeSetOutput{
+		ChangeSetName:   aws.String("giff-1234"),
+		Status:          cfTypes.ChangeSetStatusFailed,
+		StatusReason:    aws.String(client.statusReason),
+		ExecutionStatus: cfTypes.ExecutionStatusUnavailable,
+	}, nil
+}
+func (client *MockCFClientFailed) DeleteChangeSet(ctx context.Context, params *cf.DeleteChangeSetInput) (*cf.DeleteChangeSetOutput, error) {
+	client.deletedChangeSet = params.ChangeSetName
+	return &cf.DeleteChangeSetOutput{}, nil
+}
+
+func TestChanges_failed(t *testing.T) {
+	client := &MockCFClientFailed{statusReason: "The submitted information didn't contain changes. Submit different information to create a change set."}
+	cmd := NewChangesCmd(client, MockAPI{})
+	cmd.SetArgs([]string{"stack", "template"})
+	b := bytes.NewBufferString("")
+	cmd.SetOutput(b)
+	cmd.Execute()
+	assert.Equal(t, "No changes\n", b.String())
+	assert.Equal(t, aws.String("changesetID"), client.deletedChangeSet)
+
+	client = &MockCFClientFailed{statusReason: "No export named vpc-id found"}
+	cmd = NewChangesCmd(client, MockAPI{})
+	if err := cmd.ParseFlags([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Args(cmd, []string{"stack", "template"}); err != nil {
+		t.Fatal(err)
+	}
+	err := changes(cmd, client, MockAPI{})
+	assert.EqualError(t, err, "changeset giff-1234 failed: No export named vpc-id found (execution status: UNAVAILABLE)")
+	assert.Equal(t, aws.String("changesetID"), client.deletedChangeSet)
+}
+
+// MockCFClientDeleteFails can't delete the changeset
+type MockCFClientDeleteFails struct {
+	MockCFClientRecorder
+}
+
+func (client *MockCFClientDeleteFails) DeleteChangeSet(ctx context.Context, params *cf.DeleteChangeSetInput) (*cf.DeleteChangeSetOutput, error) {
+	return nil, errors.New("access denied")
+}
+
+func TestChanges_cleanup_errors(t *testing.T) {
+	api := MockAPITemplate{body: bigTemplate}
+	MockDeletedTemplate = ""
+	client := &MockCFClientDeleteFails{}
+	cmd := NewChangesCmd(client, api)
+	cmd.SetOutput(bytes.NewBufferString(""))
+	if err := cmd.ParseFlags([]string{"--s3-bucket", "bucket"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Args(cmd, []string{"stack", "template"}); err != nil {
+		t.Fatal(err)
+	}
+	err := changes(cmd, client, api)
+	assert.EqualError(t, err, "cannot delete the changeset: access denied")
+	// the uploaded template is deleted anyway
+	assert.Equal(t, MockUploadedTemplate, MockDeletedTemplate)
+}
+
+// MockCFClientCreateFails can't create the changeset
+type MockCFClientCreateFails struct {
+	MockCFClientNoChanges
+}
+
+func (client MockCFClientCreateFails) CreateChangeSet(ctx context.Context, params *cf.CreateChangeSetInput) (*cf.CreateChangeSetOutput, error) {
+	return nil, errors.New("template format error")
+}
+
+func TestChanges_create_fails(t *testing.T) {
+	api := MockAPITemplate{body: bigTemplate}
+	MockUploadedTemplate = ""
+	MockDeletedTemplate = ""
+	client := MockCFClientCreateFails{}
+	cmd := NewChangesCmd(client, api)
+	cmd.SetOutput(bytes.NewBufferString(""))
+	if err := cmd.ParseFlags([]string{"--s3-bucket", "bucket"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Args(cmd, []string{"stack", "template"}); err != nil {
+		t.Fatal(err)
+	}
+	err := changes(cmd, client, api)
+	assert.EqualError(t, err, "template format error")
+	// the template uploaded before the changeset is deleted
+	assert.NotEmpty(t, MockUploadedTemplate)
+	assert.Equal(t, MockUploadedTemplate, MockDeletedTemplate)
+}
+
+// MockCFClientCreateInterrupted is interrupted while creating the changeset
+// and records its name
+type MockCFClientCreateInterrupted struct {
+	MockCFClientInterrupted
+	createdChangeSet *string
+}
+
+func (client *MockCFClientCreateInterrupted) CreateChangeSet(ctx context.Context, params *cf.CreateChangeSetInput) (*cf.CreateChangeSetOutput, error) {
+	client.createdChangeSet = params.ChangeSetName
+	return nil, ctx.Err()
+}
+
+func TestChanges_create_interrupted(t *testing.T) {
+	client := &MockCFClientCreateInterrupted{}
+	cmd := NewChangesCmd(client, MockAPI{})
+	cmd.SetArgs([]string{"stack", "template"})
+	cmd.SetOutput(bytes.NewBufferString(""))
+	cmd.Run = func(*cobra.Command, []string) {}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := cmd.ExecuteContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+	err := changes(cmd, client, MockAPI{})
+	assert.Equal(t, context.Canceled, err)
+	// the arn is unknown, the changeset is deleted by name
+	assert.NotNil(t, client.createdChangeSet)
+	assert.Equal(t, client.createdChangeSet, client.deletedChangeSet)
+	assert.NoError(t, client.deleteCtxErr)
+}
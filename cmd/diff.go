@@ -1,11 +1,18 @@
 package cmd
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path"
+	"strings"
+	"time"
 
-	"github.com/aws/aws-sdk-go-v2/service/cloudformation"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	cfTypes "github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
 	"github.com/danpizz/giff/pkg"
 
 	"github.com/spf13/cobra"
@@ -13,56 +20,418 @@ import (
 
 func NewDiffCmd(cfClient pkg.CFAPI, apiClient pkg.API) (diffCmd *cobra.Command) {
 	diffCmd = &cobra.Command{
-		Use:   "diff stackname template",
-		Short: "Show the differences between a CloudFormation stack and a local template",
-		Long:  "Dowload a stack template and run run the diff command over it and a local template",
+		Use:   "diff stackname template|stack:stackname",
+		Short: "Show the differences between a CloudFormation stack and a local template or another stack",
+		Long: "Download a stack template and show its differences with a local template, using the built-in unified diff or an external diff command.\n" +
+			"The stack parameters, tags and outputs are compared too, with the ones the stack would have after deploying the template with the -a, -p and -t flags.\n" +
+			"With a stack:name second argument compare two deployed stacks, their templates, parameters, tags and outputs. " +
+			"A stack can be in another region or use another profile: stack:name,region=eu-west-1,profile=prod",
 		Run: func(cmd *cobra.Command, args []string) {
 			if err := diff(cmd, args, cfClient, apiClient); err != nil {
 				fmt.Fprintf(os.Stderr, "error: %v\n", err)
 				os.Exit(1)
 			}
 		},
-		Args:    cobra.ExactArgs(2),
-		Example: "giff diff my-stack my-template.yaml\n",
+		Args: cobra.ExactArgs(2),
+		Example: "giff diff my-stack my-template.yaml\n" +
+			"giff diff my-stack my-template.yaml -U 10\n" +
+			"giff diff my-stack my-template.yaml -d colordiff\n" +
+			"giff diff my-stack my-template.yaml -d 'git diff --no-index --word-diff {old} {new}'\n" +
+			"giff diff my-stack my-template.yaml -d 'vimdiff {old} {new}' -i\n" +
+			"giff diff my-stack my-template.yaml --semantic\n" +
+			"giff diff my-stack my-template.yaml -p 'Env=prod Size=2' -t 'team=ops'\n" +
+			"giff diff my-stack my-template.yaml --ignore 'Resources.*.Metadata' --ignore Description\n" +
+			"giff diff my-sam-stack my-sam-template.yaml --stage processed\n" +
+			"giff diff my-stack s3://my-bucket/my-template.yaml\n" +
+			"giff diff stack:staging-app stack:prod-app\n" +
+			"giff diff stack:my-app,region=eu-west-1 stack:my-app,region=us-east-1,profile=prod\n",
 	}
-	diffCmd.Flags().StringVarP(&diffCommand, "diff-command", "d", "diff", "Command on the PATH to use to create the diff")
+	diffCmd.Flags().StringVarP(&diffCommand, "diff-command", "d", "", "Command line to use to create the diff instead of the built-in unified diff, {old} and {new} are replaced by the names of the templates: \"difft {old} {new}\"")
+	diffCmd.Flags().BoolVarP(&interactive, "interactive", "i", false, "Run the --diff-command attached to the terminal, for tools like vimdiff")
+	diffCmd.Flags().IntVarP(&contextLines, "context", "U", pkg.DefaultContextLines, "Number of context lines of the built-in unified diff")
+	diffCmd.Flags().BoolVarP(&normalize, "normalize", "n", false, "Rewrite both templates in a canonical YAML form before the diff, always done when one template is JSON and the other YAML")
+	diffCmd.Flags().BoolVar(&semantic, "semantic", false, "Compare the parsed templates and show the changed values by path, like Resources.MyRole.Properties.RoleName")
+	diffCmd.Flags().StringVar(&templateStage, "stage", "original", "Template stage to compare: \"original\" or \"processed\", the template after transforms like AWS::Serverless-2016-10-31")
+	diffCmd.Flags().DurationVar(&diffWaitTimeout, "wait-timeout", pkg.DefaultWaitTimeout, "Maximum time to wait for the changeset of --stage processed, like 90s or 30m")
+	diffCmd.Flags().StringVar(&diffS3Endpoint, "s3-endpoint", "", "Custom S3 endpoint URL, for S3 compatible services")
+	diffCmd.Flags().StringArrayVarP(&diffAllParameters, "all-parameters", "a", nil, "All the template parameters to compare with the stack parameters, like giff changes, can be repeated: \"par1=value1 par2='value 2' ...\"")
+	diffCmd.Flags().StringArrayVarP(&diffParametersOverride, "parameters-overrides", "p", nil, "The parameters to override, like giff changes, can be repeated. If you don't specify a parameter, the stack's existing value is used. \"par1=value1 par2='value 2' ...\"")
+	diffCmd.Flags().StringArrayVar(&ignorePatterns, "ignore", nil, "Path pattern of the template values to ignore, like Resources.*.Metadata or Description, can be repeated")
+	diffCmd.Flags().StringVar(&ignoreFileName, "ignore-file", defaultIgnoreFileName, "File with the path patterns to ignore, one per line")
+	diffCmd.Flags().StringArrayVarP(&diffTags, "tags", "t", nil, "The tags to compare with the stack tags, like giff changes, can be repeated. \"tag1=value1 tag2='value 2' ...\"")
 	return diffCmd
 }
 
 var diffCommand string
+var interactive bool
+var contextLines int
+var semantic bool
+var normalize bool
+var templateStage string
+var diffS3Endpoint string
+var diffWaitTimeout time.Duration
+var diffAllParameters []string
+var diffParametersOverride []string
+var diffTags []string
+var ignorePatterns []string
+var ignoreFileName string
+
+const defaultIgnoreFileName = ".giffignore"
 
 func init() {
 	rootCmd.AddCommand(NewDiffCmd(nil, nil))
 }
 
 func diff(cmd *cobra.Command, args []string, cfClient pkg.CFAPI, apiClient pkg.API) (err error) {
-	stackName := args[0]
+	ctx := commandContext(cmd)
+	stackRef, err := pkg.ParseStackRef(args[0])
+	if err != nil {
+		return err
+	}
+	stackName := stackRef.Name
 	templateFileName := args[1]
-	if cfClient == nil {
-		cfClient, err = pkg.NewCFClient()
-		if err != nil {
-			return err
-		}
+	ignore, err := readIgnorePatterns(cmd)
+	if err != nil {
+		return err
 	}
-
-	stackTemplateOut, err := cfClient.GetTemplate(&cloudformation.GetTemplateInput{
-		StackName: &stackName,
-	})
+	stackClient, err := stackCFClient(cfClient, stackRef)
 	if err != nil {
 		return err
 	}
+	if apiClient == nil {
+		apiClient = pkg.APIClient{S3Endpoint: diffS3Endpoint}
+	}
+
+	var stage cfTypes.TemplateStage
+	switch templateStage {
+	case "original":
+		stage = cfTypes.TemplateStageOriginal
+	case "processed":
+		stage = cfTypes.TemplateStageProcessed
+	default:
+		return fmt.Errorf("invalid stage %q, must be \"original\" or \"processed\"", templateStage)
+	}
+	if diffWaitTimeout <= 0 {
+		return fmt.Errorf("--wait-timeout must be positive")
+	}
 
-	templateFileData, err := ioutil.ReadFile(templateFileName)
+	stackTemplate, err := pkg.GetTemplate(ctx, stackClient, stackName, stage)
 	if err != nil {
 		return err
 	}
 
-	diffOut, err := pkg.Diff("giff", diffCommand, []byte(*stackTemplateOut.TemplateBody), templateFileData)
+	var templateFileData string
+	var newFileName string
+	var otherRef pkg.StackRef
+	var otherClient pkg.CFAPI
+	var allParameters, parametersOverride []cfTypes.Parameter
+	var tags []cfTypes.Tag
+	compareTwoStacks := pkg.IsStackRef(templateFileName)
+	if compareTwoStacks {
+		if len(diffAllParameters) > 0 || len(diffParametersOverride) > 0 || len(diffTags) > 0 {
+			return fmt.Errorf("parameters and tags cannot be set when comparing two stacks")
+		}
+		otherRef, err = pkg.ParseStackRef(templateFileName)
+		if err != nil {
+			return err
+		}
+		otherClient, err = stackCFClient(cfClient, otherRef)
+		if err != nil {
+			return err
+		}
+		templateFileData, err = pkg.GetTemplate(ctx, otherClient, otherRef.Name, stage)
+		if err != nil {
+			return err
+		}
+		newFileName = otherRef.Name + ".deployed"
+	} else {
+		// the same parameters are used to process the template and to
+		// compare the stack settings
+		allParameters, err = parameterListFromFlag(diffAllParameters)
+		if err != nil {
+			return err
+		}
+		parametersOverride, err = parameterListFromFlag(diffParametersOverride)
+		if err != nil {
+			return err
+		}
+		tags, err = tagListFromFlag(diffTags)
+		if err != nil {
+			return err
+		}
+		templateFileData, err = apiClient.ReadTemplateFile(ctx, templateFileName)
+		if err != nil {
+			return err
+		}
+		if stage == cfTypes.TemplateStageProcessed {
+			templateFileData, err = processTemplate(ctx, stackClient, stackName, templateFileName, templateFileData, stackTemplate, allParameters, parametersOverride)
+			if err != nil {
+				return err
+			}
+		}
+		newFileName = strings.TrimSuffix(path.Base(templateFileName), path.Ext(templateFileName)) + ".local"
+	}
+
+	// the template diff is shown even if the settings can't be compared
+	if err := templateDiff(cmd, args[0], templateFileName, stackName+".deployed", newFileName, []byte(stackTemplate), []byte(templateFileData), ignore); err != nil {
+		return err
+	}
+	var settingsChanges []pkg.TemplateChange
+	if compareTwoStacks {
+		settingsChanges, err = compareStacks(ctx, stackClient, stackName, otherClient, otherRef.Name)
+	} else {
+		settingsChanges, err = compareLocalSettings(ctx, stackClient, stackName, []byte(templateFileData), allParameters, parametersOverride, tags)
+	}
 	if err != nil {
 		return err
 	}
+	printTemplateChanges(cmd, pkg.RemoveIgnoredChanges(settingsChanges, ignore))
+	return nil
+}
+
+// templateDiff prints the differences between two templates, oldName and
+// newName are the labels of the built-in diff, oldFileName and newFileName
+// the names of the files passed to the external diff command without the
+// extension. The values matched by the ignore patterns are removed from both
+// the templates, that are normalized.
+func templateDiff(cmd *cobra.Command, oldName string, newName string, oldFileName string, newFileName string, oldBody []byte, newBody []byte, ignore []pkg.IgnorePattern) (err error) {
+	if semantic {
+		return semanticDiff(cmd, oldName, newName, oldBody, newBody, ignore)
+	}
+
+	if normalize || len(ignore) > 0 || pkg.IsJsonTemplate(oldBody) != pkg.IsJsonTemplate(newBody) {
+		oldBody, err = normalizeTemplate(oldBody, ignore)
+		if err != nil {
+			return fmt.Errorf("%s: %w", oldName, err)
+		}
+		newBody, err = normalizeTemplate(newBody, ignore)
+		if err != nil {
+			return fmt.Errorf("%s: %w", newName, err)
+		}
+	}
+
+	var diffOut []byte
+	if diffCommand != "" {
+		oldFileName += templateExtension(oldBody)
+		newFileName += templateExtension(newBody)
+		if interactive {
+			return pkg.DiffInteractive(diffCommand, oldFileName, newFileName, oldBody, newBody)
+		}
+		diffOut, err = pkg.Diff(diffCommand, oldFileName, newFileName, oldBody, newBody)
+		if err != nil {
+			return err
+		}
+	} else {
+		diffOut = pkg.UnifiedDiff(oldName, newName, oldBody, newBody, contextLines)
+	}
 	if len(diffOut) > 0 {
 		cmd.Printf("%s\n", diffOut)
 	}
 	return nil
 }
+
+// stackCFClient returns the client for the region and the profile of the
+// stack, or cfClient if it's set
+func stackCFClient(cfClient pkg.CFAPI, stackRef pkg.StackRef) (pkg.CFAPI, error) {
+	if cfClient != nil {
+		return cfClient, nil
+	}
+	return pkg.NewCFClientFor(stackRef.Region, stackRef.Profile)
+}
+
+// compareLocalSettings returns the differences between the parameters, tags
+// and outputs of the stack and the ones it would have after deploying the
+// template with the -a, -p and -t flags
+func compareLocalSettings(ctx context.Context, cfClient pkg.CFAPI, stackName string, templateBody []byte, allParameters []cfTypes.Parameter, parametersOverride []cfTypes.Parameter, tags []cfTypes.Tag) ([]pkg.TemplateChange, error) {
+	template, err := pkg.ParseTemplate(templateBody)
+	if err != nil {
+		// the text diff is still useful
+		PrintfV("Not comparing the stack parameters, tags and outputs: %v\n", err)
+		return nil, nil
+	}
+	stack, err := pkg.DescribeStack(ctx, cfClient, &stackName)
+	if err != nil {
+		return nil, err
+	}
+	parameters, _, err := changeSetParameters(ctx, cfClient, stackName, false, allParameters, parametersOverride, template)
+	var missingErr *pkg.MissingParametersError
+	if errors.As(err, &missingErr) {
+		// the values are known only when the template is deployed
+		PrintfV("Not comparing the stack parameters, tags and outputs: %v\n", err)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	expected := pkg.ExpectedStackSettings(stack, template, parameters, tags)
+	return pkg.CompareStackSettings(pkg.NewStackSettings(stack), expected), nil
+}
+
+// compareStacks returns the differences of the parameters, tags and outputs
+// of two deployed stacks
+func compareStacks(ctx context.Context, oldClient pkg.CFAPI, oldStackName string, newClient pkg.CFAPI, newStackName string) ([]pkg.TemplateChange, error) {
+	oldStack, err := pkg.DescribeStack(ctx, oldClient, &oldStackName)
+	if err != nil {
+		return nil, err
+	}
+	newStack, err := pkg.DescribeStack(ctx, newClient, &newStackName)
+	if err != nil {
+		return nil, err
+	}
+	return pkg.CompareStackSettings(pkg.NewStackSettings(oldStack), pkg.NewStackSettings(newStack)), nil
+}
+
+// normalizeTemplate is pkg.NormalizeTemplate without the ignored values
+func normalizeTemplate(body []byte, ignore []pkg.IgnorePattern) ([]byte, error) {
+	template, err := pkg.ParseTemplate(body)
+	if err != nil {
+		return nil, err
+	}
+	pkg.RemoveIgnored(template, ignore)
+	return pkg.MarshalTemplate(template)
+}
+
+// readIgnorePatterns returns the --ignore patterns and the ones in the ignore
+// file, the default ignore file is optional
+func readIgnorePatterns(cmd *cobra.Command) ([]pkg.IgnorePattern, error) {
+	var patterns []pkg.IgnorePattern
+	if ignoreFileName != "" {
+		data, err := ioutil.ReadFile(ignoreFileName)
+		switch {
+		case os.IsNotExist(err) && !cmd.Flags().Changed("ignore-file"):
+		case err != nil:
+			return nil, err
+		default:
+			patterns, err = pkg.ParseIgnoreFile(data)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", ignoreFileName, err)
+			}
+		}
+	}
+	for _, s := range ignorePatterns {
+		pattern, err := pkg.ParseIgnorePattern(s)
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+func templateExtension(body []byte) string {
+	if pkg.IsJsonTemplate(body) {
+		return ".json"
+	}
+	return ".yaml"
+}
+
+// processTemplate returns the local template after the transforms, expanded
+// by CloudFormation in a temporary changeset with the -a and -p parameters
+func processTemplate(ctx context.Context, cfClient pkg.CFAPI, stackName string, templateFileName string, templateBody string, processedStackTemplate string, allParameters []cfTypes.Parameter, parametersOverride []cfTypes.Parameter) (string, error) {
+	// a template that can't be parsed is reported by CloudFormation
+	template, _ := pkg.ParseTemplate([]byte(templateBody))
+	parameters, _, err := changeSetParameters(ctx, cfClient, stackName, false, allParameters, parametersOverride, template)
+	if err != nil {
+		return "", err
+	}
+	changeSetOptions := pkg.ChangeSetOptions{
+		ChangeSetName: aws.String(pkg.NewChangeSetName()),
+		ChangeSetType: cfTypes.ChangeSetTypeUpdate,
+		StackName:     &stackName,
+		TemplateBody:  &templateBody,
+		Parameters:    parameters,
+		Capabilities: []cfTypes.Capability{
+			cfTypes.CapabilityCapabilityNamedIam,
+			cfTypes.CapabilityCapabilityAutoExpand,
+		},
+	}
+	// CloudFormation reads only the templates on S3, the ones downloaded
+	// from other URLs are sent like the local ones
+	if _, _, ok := pkg.ParseS3Url(templateFileName, diffS3Endpoint); ok {
+		templateUrl, err := pkg.TemplateUrl(templateFileName, diffS3Endpoint)
+		if err != nil {
+			return "", err
+		}
+		changeSetOptions.TemplateURL = &templateUrl
+	} else if len(templateBody) > pkg.MaxTemplateBodySize {
+		return "", fmt.Errorf("the template is bigger than %d bytes, upload it to S3 and use its URL", pkg.MaxTemplateBodySize)
+	}
+
+	PrintfV("Creating changeset...")
+	changeSetArn, err := pkg.CreateChangeSet(ctx, cfClient, changeSetOptions)
+	if err != nil {
+		PrintfV("\n")
+		if ctx.Err() != nil {
+			// the changeset may have been created before the interrupt
+			ctx, cancel := cleanupContext()
+			defer cancel()
+			if err := pkg.DeleteChangesetByName(ctx, cfClient, &stackName, changeSetOptions.ChangeSetName); err != nil {
+				PrintfV("Cannot delete the changeset: %v\n", err)
+			}
+		}
+		return "", err
+	}
+	PrintfV("ok\n")
+	defer func() {
+		// the changeset is deleted also when the command is interrupted
+		ctx, cancel := cleanupContext()
+		defer cancel()
+		PrintfV("Deleting changeset...")
+		if err := pkg.DeleteChangeset(ctx, cfClient, &changeSetArn); err != nil {
+			PrintfV("%v\n", err)
+			return
+		}
+		PrintfV("ok\n")
+	}()
+
+	out, err := pkg.WaitForChangeSet(ctx, cfClient, changeSetArn, pkg.WaitOptions{Timeout: diffWaitTimeout}, PrintfV)
+	if err != nil {
+		return "", err
+	}
+	if pkg.IsEmptyChangeSet(out) {
+		// same resources of the stack
+		return processedStackTemplate, nil
+	}
+	if err = pkg.ChangeSetError(out); err != nil {
+		return "", fmt.Errorf("cannot process the template: %w", err)
+	}
+	return pkg.GetTemplate(ctx, cfClient, changeSetArn, cfTypes.TemplateStageProcessed)
+}
+
+func semanticDiff(cmd *cobra.Command, oldName string, newName string, oldBody []byte, newBody []byte, ignore []pkg.IgnorePattern) error {
+	oldTemplate, err := pkg.ParseTemplate(oldBody)
+	if err != nil {
+		return fmt.Errorf("%s: %w", oldName, err)
+	}
+	newTemplate, err := pkg.ParseTemplate(newBody)
+	if err != nil {
+		return fmt.Errorf("%s: %w", newName, err)
+	}
+	pkg.RemoveIgnored(oldTemplate, ignore)
+	pkg.RemoveIgnored(newTemplate, ignore)
+	printTemplateChanges(cmd, pkg.CompareTemplates(oldTemplate, newTemplate))
+	return nil
+}
+
+func printTemplateChanges(cmd *cobra.Command, changes []pkg.TemplateChange) {
+	section := ""
+	for _, c := range changes {
+		if c.Section != section {
+			section = c.Section
+			cmd.Printf("%s\n", section)
+		}
+		switch c.Kind {
+		case pkg.TemplateChangeAdd:
+			cmd.Printf("+ %s: %s\n", c.Path, compactJson(c.NewValue))
+		case pkg.TemplateChangeRemove:
+			cmd.Printf("- %s: %s\n", c.Path, compactJson(c.OldValue))
+		case pkg.TemplateChangeModify:
+			cmd.Printf("* %s: %s -> %s\n", c.Path, compactJson(c.OldValue), compactJson(c.NewValue))
+		}
+	}
+}
+
+func compactJson(i interface{}) string {
+	s, _ := json.Marshal(i)
+	return string(s)
+}
@@ -0,0 +1,349 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	cf "github.com/aws/aws-sdk-go-v2/service/cloudformation"
+	cfTypes "github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
+	"github.com/stretchr/testify/assert"
+)
+
+type MockCFClientTemplate struct {
+	MockCFClientNoChanges
+}
+
+func (client MockCFClientTemplate) GetTemplate(ctx context.Context, params *cf.GetTemplateInput) (*cf.GetTemplateOutput, error) {
+	return &cf.GetTemplateOutput{
+		TemplateBody: aws.String("<deployed template>\n"),
+	}, nil
+}
+
+func TestDiff_builtin(t *testing.T) {
+	cmd := NewDiffCmd(MockCFClientTemplate{}, MockAPI{})
+	cmd.SetArgs([]string{"stack", "template"})
+	b := bytes.NewBufferString("")
+	cmd.SetOutput(b)
+	cmd.Execute()
+	out, err := ioutil.ReadAll(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t,
+		"--- stack\n"+
+			"+++ template\n"+
+			"@@ -1 +1 @@\n"+
+			"-<deployed template>\n"+
+			"+<template>\n"+
+			"\\ No newline at end of file\n\n",
+		string(out))
+}
+
+// semanticTemplate is the local template compared with the one of
+// MockCFClientSemantic
+const semanticTemplate = "Resources:\n  R:\n    Type: T\n    Properties:\n      L: [a, !Ref P]\n"
+
+type MockCFClientSemantic struct {
+	MockCFClientNoChanges
+}
+
+func (client MockCFClientSemantic) GetTemplate(ctx context.Context, params *cf.GetTemplateInput) (*cf.GetTemplateOutput, error) {
+	return &cf.GetTemplateOutput{
+		TemplateBody: aws.String(`{"Resources": {"R": {"Type": "T", "Properties": {"L": ["a", "b"]}}, "S": {"Type": "T"}}}`),
+	}, nil
+}
+
+func TestDiff_semantic(t *testing.T) {
+	api := MockAPITemplate{body: semanticTemplate}
+	cmd := NewDiffCmd(MockCFClientSemantic{}, api)
+	cmd.SetArgs([]string{"stack", "template", "--semantic"})
+	b := bytes.NewBufferString("")
+	cmd.SetOutput(b)
+	cmd.Execute()
+	out, err := ioutil.ReadAll(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t,
+		"Resources\n"+
+			"* Resources.R.Properties.L[1]: \"b\" -> {\"Ref\":\"P\"}\n"+
+			"- Resources.S: {\"Type\":\"T\"}\n",
+		string(out))
+}
+
+func TestDiff_json_and_yaml(t *testing.T) {
+	api := MockAPITemplate{body: semanticTemplate}
+	cmd := NewDiffCmd(MockCFClientSemantic{}, api)
+	cmd.SetArgs([]string{"stack", "template"})
+	b := bytes.NewBufferString("")
+	cmd.SetOutput(b)
+	cmd.Execute()
+	out, err := ioutil.ReadAll(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t,
+		"--- stack\n"+
+			"+++ template\n"+
+			"@@ -3,7 +3,5 @@\n"+
+			"     Properties:\n"+
+			"       L:\n"+
+			"         - a\n"+
+			"-        - b\n"+
+			"-    Type: T\n"+
+			"-  S:\n"+
+			"+        - !Ref P\n"+
+			"     Type: T\n\n",
+		string(out))
+}
+
+// MockCFClientProcessed returns the processed templates of the stack and of
+// the changeset, and records the capabilities of the changeset
+type MockCFClientProcessed struct {
+	MockCFClientNoChanges
+	capabilities []cfTypes.Capability
+	parameters   []cfTypes.Parameter
+	templateURL  *string
+	deleted      bool
+}
+
+func (client *MockCFClientProcessed) GetTemplate(ctx context.Context, params *cf.GetTemplateInput) (*cf.GetTemplateOutput, error) {
+	if params.TemplateStage != cfTypes.TemplateStageProcessed {
+		return &cf.GetTemplateOutput{TemplateBody: aws.String("Transform: AWS::Serverless-2016-10-31\n")}, nil
+	}
+	if params.ChangeSetName != nil {
+		return &cf.GetTemplateOutput{TemplateBody: aws.String(`{"Resources": {"Function": {"Type": "AWS::Lambda::Function"}, "Role": {"Type": "AWS::IAM::Role"}}}`)}, nil
+	}
+	return &cf.GetTemplateOutput{TemplateBody: aws.String(`{"Resources": {"Function": {"Type": "AWS::Lambda::Function"}}}`)}, nil
+}
+func (client *MockCFClientProcessed) CreateChangeSet(ctx context.Context, params *cf.CreateChangeSetInput) (*cf.CreateChangeSetOutput, error) {
+	client.capabilities = params.Capabilities
+	client.parameters = params.Parameters
+	client.templateURL = params.TemplateURL
+	return &cf.CreateChangeSetOutput{
+		Id: aws.String("arn:aws:cloudformation:us-east-1:123456789012:changeSet/giff-1/1"),
+	}, nil
+}
+func (client *MockCFClientProcessed) DeleteChangeSet(ctx context.Context, params *cf.DeleteChangeSetInput) (*cf.DeleteChangeSetOutput, error) {
+	client.deleted = true
+	return &cf.DeleteChangeSetOutput{}, nil
+}
+
+func TestDiff_processed(t *testing.T) {
+	client := &MockCFClientProcessed{}
+	cmd := NewDiffCmd(client, MockAPI{})
+	cmd.SetArgs([]string{"stack", "template", "--stage", "processed", "--semantic"})
+	b := bytes.NewBufferString("")
+	cmd.SetOutput(b)
+	cmd.Execute()
+	out, err := ioutil.ReadAll(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t,
+		"Resources\n"+
+			"+ Resources.Role: {\"Type\":\"AWS::IAM::Role\"}\n",
+		string(out))
+	assert.Contains(t, client.capabilities, cfTypes.CapabilityCapabilityAutoExpand)
+	assert.True(t, client.deleted)
+
+	// the template is processed with the -p parameters
+	client = &MockCFClientProcessed{}
+	cmd = NewDiffCmd(client, MockAPI{})
+	cmd.SetArgs([]string{"stack", "template", "--stage", "processed", "--semantic", "-p", "Env=prod"})
+	cmd.SetOutput(bytes.NewBufferString(""))
+	cmd.Execute()
+	assert.Exactly(t,
+		[]cfTypes.Parameter{{ParameterKey: aws.String("Env"), ParameterValue: aws.String("prod"), UsePreviousValue: aws.Bool(false)}},
+		client.parameters)
+
+	// CloudFormation reads the templates on S3, the others are sent
+	client = &MockCFClientProcessed{}
+	cmd = NewDiffCmd(client, MockAPI{})
+	cmd.SetArgs([]string{"stack", "s3://bucket/template.yaml", "--stage", "processed", "--semantic"})
+	cmd.SetOutput(bytes.NewBufferString(""))
+	cmd.Execute()
+	assert.Equal(t, aws.String("https://bucket.s3.amazonaws.com/template.yaml"), client.templateURL)
+
+	client = &MockCFClientProcessed{}
+	cmd = NewDiffCmd(client, MockAPI{})
+	cmd.SetArgs([]string{"stack", "https://example.com/template.yaml", "--stage", "processed", "--semantic"})
+	cmd.SetOutput(bytes.NewBufferString(""))
+	cmd.Execute()
+	assert.Nil(t, client.templateURL)
+	assert.True(t, client.deleted)
+}
+
+func TestDiff_command_placeholders(t *testing.T) {
+	cmd := NewDiffCmd(MockCFClientTemplate{}, MockAPI{})
+	cmd.SetArgs([]string{"stack", "dir/template.yml", "-d", "echo {old} {new}"})
+	b := bytes.NewBufferString("")
+	cmd.SetOutput(b)
+	cmd.Execute()
+	out, err := ioutil.ReadAll(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := strings.Fields(string(out))
+	assert.Len(t, files, 2)
+	assert.Equal(t, "stack.deployed.yaml", filepath.Base(files[0]))
+	assert.Equal(t, "template.local.yaml", filepath.Base(files[1]))
+}
+
+type MockCFClientStacks struct {
+	MockCFClientNoChanges
+}
+
+func (client MockCFClientStacks) GetTemplate(ctx context.Context, params *cf.GetTemplateInput) (*cf.GetTemplateOutput, error) {
+	return &cf.GetTemplateOutput{
+		TemplateBody: aws.String("Resources:\n  R:\n    Type: T\n    Properties:\n      Name: " + *params.StackName + "\n"),
+	}, nil
+}
+
+func (client MockCFClientStacks) DescribeStacks(ctx context.Context, params *cf.DescribeStacksInput) (*cf.DescribeStacksOutput, error) {
+	return &cf.DescribeStacksOutput{
+		Stacks: []cfTypes.Stack{{
+			StackName: params.StackName,
+			Parameters: []cfTypes.Parameter{
+				{ParameterKey: aws.String("Env"), ParameterValue: params.StackName},
+				{ParameterKey: aws.String("Size"), ParameterValue: aws.String("1")},
+			},
+			Tags: []cfTypes.Tag{{Key: aws.String("stack"), Value: params.StackName}},
+		}},
+	}, nil
+}
+
+func TestDiff_stacks(t *testing.T) {
+	cmd := NewDiffCmd(MockCFClientStacks{}, MockAPI{})
+	cmd.SetArgs([]string{"stack:staging", "stack:prod"})
+	b := bytes.NewBufferString("")
+	cmd.SetOutput(b)
+	cmd.Execute()
+	out, err := ioutil.ReadAll(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t,
+		"--- stack:staging\n"+
+			"+++ stack:prod\n"+
+			"@@ -2,4 +2,4 @@\n"+
+			"   R:\n"+
+			"     Type: T\n"+
+			"     Properties:\n"+
+			"-      Name: staging\n"+
+			"+      Name: prod\n"+
+			"\n"+
+			"StackParameters\n"+
+			"* StackParameters.Env: \"staging\" -> \"prod\"\n"+
+			"StackTags\n"+
+			"* StackTags.stack: \"staging\" -> \"prod\"\n",
+		string(out))
+}
+
+type MockCFClientSettings struct {
+	MockCFClientNoChanges
+}
+
+func (client MockCFClientSettings) GetTemplate(ctx context.Context, params *cf.GetTemplateInput) (*cf.GetTemplateOutput, error) {
+	return &cf.GetTemplateOutput{
+		TemplateBody: aws.String("Parameters:\n  Env: {Type: String}\n  Password: {Type: String, NoEcho: true}\nOutputs:\n  Url: {Value: !Ref Env}\n  Old: {Value: x}\n"),
+	}, nil
+}
+
+func (client MockCFClientSettings) DescribeStacks(ctx context.Context, params *cf.DescribeStacksInput) (*cf.DescribeStacksOutput, error) {
+	return &cf.DescribeStacksOutput{
+		Stacks: []cfTypes.Stack{{
+			Parameters: []cfTypes.Parameter{
+				{ParameterKey: aws.String("Env"), ParameterValue: aws.String("staging")},
+				{ParameterKey: aws.String("Password"), ParameterValue: aws.String("****")},
+			},
+			Tags: []cfTypes.Tag{{Key: aws.String("team"), Value: aws.String("dev")}},
+			Outputs: []cfTypes.Output{
+				{OutputKey: aws.String("Url"), OutputValue: aws.String("staging")},
+				{OutputKey: aws.String("Old"), OutputValue: aws.String("x")},
+			},
+		}},
+	}, nil
+}
+
+func TestDiff_settings(t *testing.T) {
+	api := MockAPITemplate{body: "Parameters:\n  Env: {Type: String}\n  Password: {Type: String, NoEcho: true}\n  Size: {Type: Number, Default: 1}\nOutputs:\n  Url: {Value: !Ref Env}\n"}
+	cmd := NewDiffCmd(MockCFClientSettings{}, api)
+	cmd.SetArgs([]string{"stack", "template", "--semantic", "-p", "Env=prod Password=secret", "-t", "team=ops"})
+	b := bytes.NewBufferString("")
+	cmd.SetOutput(b)
+	cmd.Execute()
+	out, err := ioutil.ReadAll(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t,
+		"Parameters\n"+
+			"+ Parameters.Size: {\"Default\":\"1\",\"Type\":\"Number\"}\n"+
+			"Outputs\n"+
+			"- Outputs.Old: {\"Value\":\"x\"}\n"+
+			"StackParameters\n"+
+			"* StackParameters.Env: \"staging\" -> \"prod\"\n"+
+			"+ StackParameters.Size: \"1\"\n"+
+			"StackTags\n"+
+			"* StackTags.team: \"dev\" -> \"ops\"\n"+
+			"StackOutputs\n"+
+			"- StackOutputs.Old: \"x\"\n",
+		string(out))
+}
+
+func TestDiff_ignore(t *testing.T) {
+	api := MockAPITemplate{body: semanticTemplate}
+	cmd := NewDiffCmd(MockCFClientSemantic{}, api)
+	cmd.SetArgs([]string{"stack", "template", "--ignore", "Resources.S", "--ignore", "Resources.*.Properties.L[1]"})
+	b := bytes.NewBufferString("")
+	cmd.SetOutput(b)
+	cmd.Execute()
+	out, err := ioutil.ReadAll(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "", string(out))
+}
+
+func TestDiff_ignore_file(t *testing.T) {
+	api := MockAPITemplate{body: semanticTemplate}
+	ignoreFile := filepath.Join(t.TempDir(), "ignore")
+	if err := ioutil.WriteFile(ignoreFile, []byte("# deleted\nResources.S\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cmd := NewDiffCmd(MockCFClientSemantic{}, api)
+	cmd.SetArgs([]string{"stack", "template", "--semantic", "--ignore-file", ignoreFile})
+	b := bytes.NewBufferString("")
+	cmd.SetOutput(b)
+	cmd.Execute()
+	out, err := ioutil.ReadAll(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t,
+		"Resources\n"+
+			"* Resources.R.Properties.L[1]: \"b\" -> {\"Ref\":\"P\"}\n",
+		string(out))
+}
+
+func TestDiff_required_parameter(t *testing.T) {
+	api := MockAPITemplate{body: "Parameters:\n  Env: {Type: String}\n  Password: {Type: String, NoEcho: true}\n  Vpc: {Type: String}\nOutputs:\n  Url: {Value: !Ref Env}\n  Old: {Value: x}\n"}
+	cmd := NewDiffCmd(MockCFClientSettings{}, api)
+	if err := cmd.ParseFlags([]string{"--semantic"}); err != nil {
+		t.Fatal(err)
+	}
+	b := bytes.NewBufferString("")
+	cmd.SetOutput(b)
+	err := diff(cmd, []string{"stack", "template"}, MockCFClientSettings{}, api)
+	assert.NoError(t, err)
+	assert.Equal(t,
+		"Parameters\n"+
+			"+ Parameters.Vpc: {\"Type\":\"String\"}\n",
+		b.String())
+}
@@ -1,9 +1,13 @@
 package cmd
 
 import (
+	"context"
 	"encoding/json"
 	"io"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
 )
@@ -27,7 +31,15 @@ func Execute() {
 	} else {
 		rootCmd.SetErr(os.Stderr)
 	}
-	if err := rootCmd.Execute(); err != nil {
+	// Ctrl-C cancels the context of the commands, that delete their
+	// temporary changesets before exiting. A second Ctrl-C kills giff.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	if err := rootCmd.ExecuteContext(ctx); err != nil {
 		rootCmd.PrintErrln(err)
 		os.Exit(1)
 	}
@@ -39,9 +51,28 @@ func init() {
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "verbose output")
 }
 
+// cleanupTimeout bounds the deletion of the temporary changesets and stacks
+const cleanupTimeout = 30 * time.Second
+
+// commandContext returns the context of the command, cancelled by Ctrl-C
+func commandContext(cmd *cobra.Command) context.Context {
+	if ctx := cmd.Context(); ctx != nil {
+		return ctx
+	}
+	return context.Background()
+}
+
+// cleanupContext returns the context of the deletion of the temporary
+// resources, that is not cancelled with the command
+func cleanupContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), cleanupTimeout)
+}
+
+// PrintfV prints the verbose output on stderr, stdout is kept for the
+// results like the --output json report
 func PrintfV(format string, a ...interface{}) {
 	if verbose {
-		rootCmd.Printf(format, a...)
+		rootCmd.PrintErrf(format, a...)
 	}
 }
 
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"io/ioutil"
 	"os"
+	"regexp"
 	"testing"
 
 	"github.com/danpizz/giff/cmd"
@@ -30,7 +31,8 @@ func TestCLI_changes_sample_2(t *testing.T) {
 	out, _ := ioutil.ReadAll(b)
 	assert.Exactly(t,
 		"+     add: SampleRole2 - AWS::IAM::Role\n"+
-			"*  modify: SampleRole (sample-giff-stack-sample-role) - AWS::IAM::Role / replacement: False / scope: Tags\n",
+			"*  modify: SampleRole (sample-giff-stack-sample-role) - AWS::IAM::Role / replacement: False / scope: Tags\n"+
+			"           └─ Tags / recreation: Never / source: DirectModification\n",
 		string(out))
 }
 
@@ -42,7 +44,9 @@ func TestCLI_changes_sample_3(t *testing.T) {
 	out, _ := ioutil.ReadAll(b)
 	assert.Exactly(t,
 		"+     add: SampleRole2 - AWS::IAM::Role\n"+
-			"-  remove: SampleRole - AWS::IAM::Role\n",
+			"-  remove: SampleRole - AWS::IAM::Role\n"+
+			"Parameters:\n"+
+			"+  MyTag: hello / overridden\n",
 		string(out))
 }
 
@@ -52,7 +56,12 @@ func TestCLI_changes_param_and_tag(t *testing.T) {
 	cmd.Out = b
 	main()
 	out, _ := ioutil.ReadAll(b)
-	assert.Exactly(t,
-		"*  modify: Volume (vol-049ee452fc2a8cd03) - AWS::EC2::Volume / replacement: False / scope: Properties Tags\n",
+	assert.Regexp(t,
+		"^"+regexp.QuoteMeta("*  modify: Volume (vol-049ee452fc2a8cd03) - AWS::EC2::Volume / replacement: False / scope: Properties Tags\n"+
+			"           ├─ Properties.Size / recreation: Never / source: DirectModification\n"+
+			"           ├─ Tags / recreation: Never / source: DirectModification\n"+
+			"           └─ Properties.Size / recreation: Never / source: ParameterReference (Size)\n"+
+			"Parameters:\n"+
+			"*  Size: ")+".* -> 2 / overridden\n$",
 		string(out))
 }
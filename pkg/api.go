@@ -1,23 +1,37 @@
 package pkg
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"io/ioutil"
-	"time"
+	"net/http"
+	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	cf "github.com/aws/aws-sdk-go-v2/service/cloudformation"
 	cfTypes "github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
 	"github.com/dchest/uniuri"
 )
 
 type API interface {
-	ReadTemplateFile(templateFileName string) (body string, err error)
+	ReadTemplateFile(ctx context.Context, templateFileName string) (body string, err error)
+	UploadTemplate(ctx context.Context, bucket string, key string, body string) (url string, err error)
+	DeleteTemplate(ctx context.Context, bucket string, key string) error
 }
 type APIClient struct {
+	// S3Endpoint, if not empty, is used instead of the AWS S3 endpoint
+	S3Endpoint string
 }
 
-func (APIClient) ReadTemplateFile(templateFileName string) (body string, err error) {
+// ReadTemplateFile reads a local template, or downloads it if templateFileName
+// is an s3:// or https:// URL
+func (client APIClient) ReadTemplateFile(ctx context.Context, templateFileName string) (body string, err error) {
+	if IsTemplateUrl(templateFileName) {
+		return client.downloadTemplate(ctx, templateFileName)
+	}
 	templateFileBytes, err := ioutil.ReadFile(templateFileName)
 	if err != nil {
 		return
@@ -26,78 +40,291 @@ func (APIClient) ReadTemplateFile(templateFileName string) (body string, err err
 	return
 }
 
-func GetStackParameters(api CFAPI, stackName *string) ([]cfTypes.Parameter, error) {
-	describeStacksOutput, err := api.DescribeStacks(&cf.DescribeStacksInput{
+func (client APIClient) downloadTemplate(ctx context.Context, templateUrl string) (string, error) {
+	if bucket, key, ok := ParseS3Url(templateUrl, client.S3Endpoint); ok {
+		s3Client, err := NewS3Client(client.S3Endpoint)
+		if err != nil {
+			return "", err
+		}
+		return ReadS3Template(ctx, s3Client, bucket, key)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, templateUrl, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("cannot download %s: %s", templateUrl, resp.Status)
+	}
+	templateBytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	return string(templateBytes), nil
+}
+
+// UploadTemplate uploads a template to S3 and returns its URL
+func (client APIClient) UploadTemplate(ctx context.Context, bucket string, key string, body string) (string, error) {
+	s3Client, err := NewS3Client(client.S3Endpoint)
+	if err != nil {
+		return "", err
+	}
+	_, err = s3Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+		Body:   strings.NewReader(body),
+	})
+	if err != nil {
+		return "", err
+	}
+	return S3ObjectUrl(client.S3Endpoint, s3Client.Region, bucket, key), nil
+}
+
+func (client APIClient) DeleteTemplate(ctx context.Context, bucket string, key string) error {
+	s3Client, err := NewS3Client(client.S3Endpoint)
+	if err != nil {
+		return err
+	}
+	_, err = s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	return err
+}
+
+func ReadS3Template(ctx context.Context, api S3API, bucket string, key string) (string, error) {
+	out, err := api.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return "", err
+	}
+	defer out.Body.Close()
+	templateBytes, err := ioutil.ReadAll(out.Body)
+	if err != nil {
+		return "", err
+	}
+	return string(templateBytes), nil
+}
+
+func GetStackParameters(ctx context.Context, api CFAPI, stackName *string) ([]cfTypes.Parameter, error) {
+	stack, err := DescribeStack(ctx, api, stackName)
+	if err != nil {
+		return nil, err
+	}
+	return stack.Parameters, nil
+}
+
+func DescribeStack(ctx context.Context, api CFAPI, stackName *string) (*cfTypes.Stack, error) {
+	describeStacksOutput, err := api.DescribeStacks(ctx, &cf.DescribeStacksInput{
 		StackName: stackName,
 	})
 	if err != nil {
 		return nil, err
 	}
 	if describeStacksOutput.Stacks == nil || len(describeStacksOutput.Stacks) != 1 {
-		return nil, errors.New("cannot read stack parameters")
+		return nil, fmt.Errorf("cannot describe stack %s", aws.ToString(stackName))
+	}
+	return &describeStacksOutput.Stacks[0], nil
+}
+
+// FindStack returns the description of the stack, or nil if it doesn't
+// exist
+func FindStack(ctx context.Context, api CFAPI, stackName *string) (*cfTypes.Stack, error) {
+	stack, err := DescribeStack(ctx, api, stackName)
+	if err == nil {
+		return stack, nil
 	}
-	return describeStacksOutput.Stacks[0].Parameters, nil
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && apiErr.ErrorCode() == "ValidationError" && strings.Contains(apiErr.ErrorMessage(), "does not exist") {
+		return nil, nil
+	}
+	return nil, err
 }
 
 const changesetBaseName = "giff"
 
-func CreateChangeSet(api CFAPI, stackName *string, templateBody *string, parameterList []cfTypes.Parameter, tagList []cfTypes.Tag) (changeSetId string, err error) {
+// NewChangeSetName returns a new name for a temporary changeset
+func NewChangeSetName() string {
+	return changesetBaseName + "-" + uniuri.New()
+}
+
+// ChangeSetOptions describes the changeset to create. ChangeSetName is a new
+// name when nil, the caller sets it to delete the changeset when the request
+// is interrupted. ChangeSetType is CREATE for a new stack, UPDATE for an
+// existing one or IMPORT. TemplateURL, when not nil, is used instead of
+// TemplateBody. Capabilities is CAPABILITY_NAMED_IAM when nil.
+type ChangeSetOptions struct {
+	ChangeSetConfig
+	ChangeSetName     *string
+	ChangeSetType     cfTypes.ChangeSetType
+	StackName         *string
+	TemplateBody      *string
+	TemplateURL       *string
+	Parameters        []cfTypes.Parameter
+	Tags              []cfTypes.Tag
+	ResourcesToImport []cfTypes.ResourceToImport
+	Capabilities      []cfTypes.Capability
+}
+
+func CreateChangeSet(ctx context.Context, api CFAPI, options ChangeSetOptions) (changeSetId string, err error) {
 
 	capabilities := []cfTypes.Capability{cfTypes.CapabilityCapabilityNamedIam}
+	if options.Capabilities != nil {
+		capabilities = options.Capabilities
+	}
 
 	createChangeSetInput := cf.CreateChangeSetInput{
-		StackName:     stackName,
-		ChangeSetName: aws.String(changesetBaseName + "-" + uniuri.New()),
-		ChangeSetType: "UPDATE",
-		TemplateBody:  templateBody,
+		StackName:     options.StackName,
+		ChangeSetName: options.ChangeSetName,
+		ChangeSetType: options.ChangeSetType,
 		Capabilities:  capabilities,
+		// the changes of the nested stacks are read by FollowNestedChangeSets
+		IncludeNestedStacks:   aws.Bool(true),
+		RoleARN:               options.RoleARN,
+		NotificationARNs:      options.NotificationARNs,
+		RollbackConfiguration: options.RollbackConfiguration,
+		Description:           options.Description,
+		ClientToken:           options.ClientToken,
+	}
+	if createChangeSetInput.ChangeSetName == nil {
+		createChangeSetInput.ChangeSetName = aws.String(NewChangeSetName())
+	}
+	if options.IncludeNestedStacks != nil {
+		createChangeSetInput.IncludeNestedStacks = options.IncludeNestedStacks
 	}
-	if parameterList != nil {
-		createChangeSetInput.Parameters = parameterList
+	if options.TemplateURL != nil {
+		createChangeSetInput.TemplateURL = options.TemplateURL
+	} else {
+		createChangeSetInput.TemplateBody = options.TemplateBody
 	}
-	if tagList != nil {
-		createChangeSetInput.Tags = tagList
+	if options.Parameters != nil {
+		createChangeSetInput.Parameters = options.Parameters
+	}
+	if options.Tags != nil {
+		createChangeSetInput.Tags = options.Tags
+	}
+	if options.ResourcesToImport != nil {
+		createChangeSetInput.ResourcesToImport = options.ResourcesToImport
+		// nested stacks are not supported by IMPORT changesets
+		createChangeSetInput.IncludeNestedStacks = nil
 	}
 
-	changesetOutput, err := api.CreateChangeSet(&createChangeSetInput)
+	changesetOutput, err := api.CreateChangeSet(ctx, &createChangeSetInput)
 	if err != nil {
 		return "", err
 	}
 	return *changesetOutput.Id, nil
 }
 
-// no waiters in the aws-sdk-go-v2 for cloudformation yet
-// https://github.com/aws/aws-sdk-go-v2/issues/1111
-func WaitForChangeSet(api CFAPI, changeSetArn string, print func(string, ...interface{})) (out *cf.DescribeChangeSetOutput, err error) {
-	var try int = 1
-	const maxRetries = 20
-	print("Reading changeset...")
-	for {
-		if try > maxRetries {
-			print("\n")
-			return &cf.DescribeChangeSetOutput{}, errors.New("max retries while waiting for changset")
-		}
-		out, err = api.DescribeChangeSet(&cf.DescribeChangeSetInput{
+// DescribeChangeSet returns the description of a changeset with the changes
+// of all its pages
+func DescribeChangeSet(ctx context.Context, api CFAPI, changeSetArn string) (*cf.DescribeChangeSetOutput, error) {
+	out, err := api.DescribeChangeSet(ctx, &cf.DescribeChangeSetInput{
+		ChangeSetName: aws.String(changeSetArn),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err = readChangeSetPages(ctx, api, changeSetArn, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// readChangeSetPages follows the NextToken of a changeset description,
+// appending the changes of the following pages to out
+func readChangeSetPages(ctx context.Context, api CFAPI, changeSetArn string, out *cf.DescribeChangeSetOutput) error {
+	for out.NextToken != nil {
+		page, err := api.DescribeChangeSet(ctx, &cf.DescribeChangeSetInput{
 			ChangeSetName: aws.String(changeSetArn),
+			NextToken:     out.NextToken,
 		})
 		if err != nil {
-			// delete changeset?
-			return
+			return err
 		}
-		if out.Status != cfTypes.ChangeSetStatusCreateComplete && out.Status != cfTypes.ChangeSetStatusFailed {
-			time.Sleep(2 * time.Second)
-			try += 1
-			print(".")
+		out.Changes = append(out.Changes, page.Changes...)
+		out.NextToken = page.NextToken
+	}
+	return nil
+}
+
+// FollowNestedChangeSets reads the changesets of the nested stacks, recursively,
+// and stores their changes in the NestedChanges of the parent stack resource.
+func FollowNestedChangeSets(ctx context.Context, api CFAPI, changes []GiffChange) error {
+	for i, c := range changes {
+		if !c.IsNestedStack() {
 			continue
 		}
-		print("ok\n")
-		return
+		out, err := DescribeChangeSet(ctx, api, *c.ChangeSetId)
+		if err != nil {
+			return err
+		}
+		nestedChanges, err := ExtractChanges(out)
+		if err != nil {
+			return err
+		}
+		if err = FollowNestedChangeSets(ctx, api, nestedChanges); err != nil {
+			return err
+		}
+		changes[i].NestedChanges = nestedChanges
+	}
+	return nil
+}
+
+// GetTemplate returns the template of a stack, or of a changeset if name is a
+// changeset ARN, at the given stage: Original or Processed (after the
+// transforms)
+func GetTemplate(ctx context.Context, api CFAPI, name string, stage cfTypes.TemplateStage) (string, error) {
+	input := cf.GetTemplateInput{
+		TemplateStage: stage,
+	}
+	if strings.HasPrefix(name, "arn:") && strings.Contains(name, ":changeSet/") {
+		input.ChangeSetName = aws.String(name)
+	} else {
+		input.StackName = aws.String(name)
+	}
+	out, err := api.GetTemplate(ctx, &input)
+	if err != nil {
+		return "", err
 	}
+	if out.TemplateBody == nil {
+		return "", fmt.Errorf("empty template for %s", name)
+	}
+	return *out.TemplateBody, nil
+}
+
+// DeleteChangesetByName deletes the changeset of a stack by its name, a
+// missing changeset is not an error
+func DeleteChangesetByName(ctx context.Context, api CFAPI, stackName *string, changeSetName *string) error {
+	_, err := api.DeleteChangeSet(ctx, &cf.DeleteChangeSetInput{
+		StackName:     stackName,
+		ChangeSetName: changeSetName,
+	})
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && apiErr.ErrorCode() == "ChangeSetNotFound" {
+		return nil
+	}
+	return err
 }
 
-func DeleteChangeset(api CFAPI, changeSetArn *string) error {
-	_, err := api.DeleteChangeSet(&cf.DeleteChangeSetInput{
+func DeleteChangeset(ctx context.Context, api CFAPI, changeSetArn *string) error {
+	_, err := api.DeleteChangeSet(ctx, &cf.DeleteChangeSetInput{
 		ChangeSetName: changeSetArn,
 	})
 	return err
 }
+
+// DeleteStack deletes a stack, it's used to remove the REVIEW_IN_PROGRESS
+// stack left by a CREATE changeset
+func DeleteStack(ctx context.Context, api CFAPI, stackName *string) error {
+	_, err := api.DeleteStack(ctx, &cf.DeleteStackInput{
+		StackName: stackName,
+	})
+	return err
+}
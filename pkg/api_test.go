@@ -0,0 +1,69 @@
+package pkg
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	cf "github.com/aws/aws-sdk-go-v2/service/cloudformation"
+	cfTypes "github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// MockCFClientPages returns a changeset split in pages of one change each
+type MockCFClientPages struct {
+	CFAPI
+	pages int
+}
+
+func (client MockCFClientPages) DescribeChangeSet(ctx context.Context, params *cf.DescribeChangeSetInput) (*cf.DescribeChangeSetOutput, error) {
+	page := 0
+	if params.NextToken != nil {
+		page, _ = strconv.Atoi(*params.NextToken)
+	}
+	out := &cf.DescribeChangeSetOutput{
+		ChangeSetId: params.ChangeSetName,
+		Status:      cfTypes.ChangeSetStatusCreateComplete,
+		Changes: []cfTypes.Change{
+			{
+				ResourceChange: &cfTypes.ResourceChange{
+					Action:            cfTypes.ChangeActionAdd,
+					LogicalResourceId: aws.String("Resource" + strconv.Itoa(page)),
+					ResourceType:      aws.String("RT"),
+				},
+				Type: cfTypes.ChangeTypeResource,
+			},
+		},
+	}
+	if page < client.pages-1 {
+		out.NextToken = aws.String(strconv.Itoa(page + 1))
+	}
+	return out, nil
+}
+
+func TestDescribeChangeSet_pages(t *testing.T) {
+	out, err := DescribeChangeSet(context.Background(), MockCFClientPages{pages: 2}, "changeset")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, out.Changes, 2)
+}
+
+// MockCFClientDeleteChangeSet returns err when deleting a changeset
+type MockCFClientDeleteChangeSet struct {
+	CFAPI
+	err error
+}
+
+func (client MockCFClientDeleteChangeSet) DeleteChangeSet(ctx context.Context, params *cf.DeleteChangeSetInput) (*cf.DeleteChangeSetOutput, error) {
+	return &cf.DeleteChangeSetOutput{}, client.err
+}
+
+func TestDeleteChangesetByName(t *testing.T) {
+	notFound := &smithy.GenericAPIError{Code: "ChangeSetNotFound", Message: "ChangeSet [giff-1234] does not exist"}
+	assert.NoError(t, DeleteChangesetByName(context.Background(), MockCFClientDeleteChangeSet{err: notFound}, aws.String("stack"), aws.String("giff-1234")))
+	denied := &smithy.GenericAPIError{Code: "AccessDenied", Message: "access denied"}
+	assert.Equal(t, denied, DeleteChangesetByName(context.Background(), MockCFClientDeleteChangeSet{err: denied}, aws.String("stack"), aws.String("giff-1234")))
+}
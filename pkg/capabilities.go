@@ -0,0 +1,109 @@
+package pkg
+
+import (
+	"strings"
+
+	cfTypes "github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
+)
+
+// the properties that give a custom name to an IAM resource
+var iamNameProperties = []string{"GroupName", "InstanceProfileName", "ManagedPolicyName", "RoleName", "UserName"}
+
+// DetectCapabilities returns the capabilities needed to deploy the template:
+// CAPABILITY_IAM for the IAM resources, CAPABILITY_NAMED_IAM if they have a
+// custom name and CAPABILITY_AUTO_EXPAND for transforms and macros. The
+// templates of the nested stacks are read with readTemplate, when they can't
+// be read they need all the capabilities. The result is empty, not nil, when
+// no capability is needed.
+func DetectCapabilities(template Template, readTemplate func(location string) (string, error)) []cfTypes.Capability {
+	d := capabilitiesDetector{readTemplate: readTemplate, visited: map[string]bool{}}
+	d.scan(template)
+
+	capabilities := []cfTypes.Capability{}
+	switch {
+	case d.namedIam:
+		capabilities = append(capabilities, cfTypes.CapabilityCapabilityNamedIam)
+	case d.iam:
+		capabilities = append(capabilities, cfTypes.CapabilityCapabilityIam)
+	}
+	if d.autoExpand {
+		capabilities = append(capabilities, cfTypes.CapabilityCapabilityAutoExpand)
+	}
+	return capabilities
+}
+
+type capabilitiesDetector struct {
+	readTemplate func(location string) (string, error)
+	visited      map[string]bool
+	iam          bool
+	namedIam     bool
+	autoExpand   bool
+}
+
+func (d *capabilitiesDetector) scan(template Template) {
+	if _, ok := template["Transform"]; ok || containsKey(map[string]interface{}(template), "Fn::Transform") {
+		d.autoExpand = true
+	}
+	resources, _ := template["Resources"].(map[string]interface{})
+	for _, r := range resources {
+		resource, _ := r.(map[string]interface{})
+		resourceType, _ := resource["Type"].(string)
+		properties, _ := resource["Properties"].(map[string]interface{})
+		switch {
+		case strings.HasPrefix(resourceType, "AWS::IAM::"):
+			d.iam = true
+			for _, name := range iamNameProperties {
+				if _, ok := properties[name]; ok {
+					d.namedIam = true
+				}
+			}
+		case resourceType == "AWS::Serverless::Function" || resourceType == "AWS::Serverless::StateMachine":
+			// SAM creates a role when it's not given
+			if _, ok := properties["Role"]; !ok {
+				d.iam = true
+			}
+		case resourceType == "AWS::CloudFormation::Stack":
+			d.scanNested(properties["TemplateURL"])
+		case resourceType == "AWS::Serverless::Application":
+			d.scanNested(properties["Location"])
+		}
+	}
+}
+
+func (d *capabilitiesDetector) scanNested(templateUrl interface{}) {
+	location, ok := templateUrl.(string)
+	if ok && d.visited[location] {
+		return
+	}
+	if ok && d.readTemplate != nil {
+		d.visited[location] = true
+		if body, err := d.readTemplate(location); err == nil {
+			if template, err := ParseTemplate([]byte(body)); err == nil {
+				d.scan(template)
+				return
+			}
+		}
+	}
+	d.iam = true
+	d.namedIam = true
+	d.autoExpand = true
+}
+
+// containsKey tells if a map in value has the key
+func containsKey(value interface{}, key string) bool {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for k, item := range v {
+			if k == key || containsKey(item, key) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if containsKey(item, key) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,45 @@
+package pkg
+
+import (
+	"errors"
+	"testing"
+
+	cfTypes "github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectCapabilities(t *testing.T) {
+	nested := map[string]string{
+		"s3://bucket/iam.yaml":  "Resources:\n  Role: {Type: AWS::IAM::Role}\n",
+		"s3://bucket/loop.yaml": "Resources:\n  Loop: {Type: AWS::CloudFormation::Stack, Properties: {TemplateURL: s3://bucket/loop.yaml}}\n",
+	}
+	readTemplate := func(location string) (string, error) {
+		if body, ok := nested[location]; ok {
+			return body, nil
+		}
+		return "", errors.New("not found")
+	}
+
+	tests := []struct {
+		template     string
+		capabilities []cfTypes.Capability
+	}{
+		{"Resources:\n  Bucket: {Type: AWS::S3::Bucket}\n", []cfTypes.Capability{}},
+		{"Resources:\n  Role: {Type: AWS::IAM::Role}\n", []cfTypes.Capability{cfTypes.CapabilityCapabilityIam}},
+		{"Resources:\n  Role: {Type: AWS::IAM::Role, Properties: {RoleName: r}}\n", []cfTypes.Capability{cfTypes.CapabilityCapabilityNamedIam}},
+		{"Transform: AWS::Serverless-2016-10-31\nResources:\n  F: {Type: AWS::Serverless::Function, Properties: {Role: arn}}\n", []cfTypes.Capability{cfTypes.CapabilityCapabilityAutoExpand}},
+		{"Transform: AWS::Serverless-2016-10-31\nResources:\n  F: {Type: AWS::Serverless::Function}\n", []cfTypes.Capability{cfTypes.CapabilityCapabilityIam, cfTypes.CapabilityCapabilityAutoExpand}},
+		{"Resources:\n  B:\n    Type: AWS::S3::Bucket\n    Properties:\n      Fn::Transform: {Name: Macro}\n", []cfTypes.Capability{cfTypes.CapabilityCapabilityAutoExpand}},
+		{"Resources:\n  S: {Type: AWS::CloudFormation::Stack, Properties: {TemplateURL: s3://bucket/iam.yaml}}\n", []cfTypes.Capability{cfTypes.CapabilityCapabilityIam}},
+		{"Resources:\n  S: {Type: AWS::CloudFormation::Stack, Properties: {TemplateURL: s3://bucket/loop.yaml}}\n", []cfTypes.Capability{}},
+		{"Resources:\n  S: {Type: AWS::CloudFormation::Stack, Properties: {TemplateURL: s3://bucket/missing.yaml}}\n", []cfTypes.Capability{cfTypes.CapabilityCapabilityNamedIam, cfTypes.CapabilityCapabilityAutoExpand}},
+		{"Resources:\n  S: {Type: AWS::CloudFormation::Stack, Properties: {TemplateURL: !Sub 'https://${B}/t.yaml'}}\n", []cfTypes.Capability{cfTypes.CapabilityCapabilityNamedIam, cfTypes.CapabilityCapabilityAutoExpand}},
+	}
+	for _, test := range tests {
+		template, err := ParseTemplate([]byte(test.template))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, test.capabilities, DetectCapabilities(template, readTemplate), test.template)
+	}
+}
@@ -0,0 +1,59 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	cfTypes "github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
+)
+
+// ChangeSetConfig are the options of a changeset about how the stack is
+// deployed, with the names of the CreateChangeSet input:
+//
+//	{
+//	  "RoleARN": "arn:aws:iam::123456789012:role/deploy",
+//	  "NotificationARNs": ["arn:aws:sns:us-east-1:123456789012:deploys"],
+//	  "RollbackConfiguration": {
+//	    "RollbackTriggers": [{"Arn": "arn:aws:cloudwatch:...", "Type": "AWS::CloudWatch::Alarm"}],
+//	    "MonitoringTimeInMinutes": 10
+//	  },
+//	  "Description": "release 1.2",
+//	  "ClientToken": "release-1.2",
+//	  "IncludeNestedStacks": false
+//	}
+//
+// IncludeNestedStacks is true when nil.
+type ChangeSetConfig struct {
+	RoleARN               *string
+	NotificationARNs      []string
+	RollbackConfiguration *cfTypes.RollbackConfiguration
+	Description           *string
+	ClientToken           *string
+	IncludeNestedStacks   *bool
+}
+
+// ChangeSetConfigFromJson reads a ChangeSetConfig, unknown fields are an
+// error
+func ChangeSetConfigFromJson(data []byte) (ChangeSetConfig, error) {
+	var config ChangeSetConfig
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&config); err != nil {
+		return config, fmt.Errorf("cannot read the changeset configuration: %w", err)
+	}
+	return config, nil
+}
+
+// RollbackConfigurationFromJson reads a rollback configuration in the format
+// of the AWS CLI --rollback-configuration option:
+// {"RollbackTriggers": [{"Arn": "...", "Type": "AWS::CloudWatch::Alarm"}], "MonitoringTimeInMinutes": 10}
+func RollbackConfigurationFromJson(data []byte) (*cfTypes.RollbackConfiguration, error) {
+	var rollbackConfiguration cfTypes.RollbackConfiguration
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&rollbackConfiguration); err != nil {
+		return nil, fmt.Errorf("cannot read the rollback configuration: %w", err)
+	}
+	return &rollbackConfiguration, nil
+}
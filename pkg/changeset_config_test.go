@@ -0,0 +1,43 @@
+package pkg
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	cfTypes "github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChangeSetConfigFromJson(t *testing.T) {
+	config, err := ChangeSetConfigFromJson([]byte(`{
+		"RoleARN": "role",
+		"NotificationARNs": ["topic1", "topic2"],
+		"RollbackConfiguration": {"RollbackTriggers": [{"Arn": "alarm", "Type": "AWS::CloudWatch::Alarm"}]},
+		"ClientToken": "token",
+		"IncludeNestedStacks": false
+	}`))
+	assert.NoError(t, err)
+	assert.Equal(t,
+		ChangeSetConfig{
+			RoleARN:          aws.String("role"),
+			NotificationARNs: []string{"topic1", "topic2"},
+			RollbackConfiguration: &cfTypes.RollbackConfiguration{
+				RollbackTriggers: []cfTypes.RollbackTrigger{{Arn: aws.String("alarm"), Type: aws.String("AWS::CloudWatch::Alarm")}},
+			},
+			ClientToken:         aws.String("token"),
+			IncludeNestedStacks: aws.Bool(false),
+		},
+		config)
+
+	_, err = ChangeSetConfigFromJson([]byte(`{"Role": "role"}`))
+	assert.EqualError(t, err, `cannot read the changeset configuration: json: unknown field "Role"`)
+}
+
+func TestRollbackConfigurationFromJson(t *testing.T) {
+	rollbackConfiguration, err := RollbackConfigurationFromJson([]byte(`{"MonitoringTimeInMinutes": 5}`))
+	assert.NoError(t, err)
+	assert.Equal(t, &cfTypes.RollbackConfiguration{MonitoringTimeInMinutes: aws.Int32(5)}, rollbackConfiguration)
+
+	_, err = RollbackConfigurationFromJson([]byte(`[]`))
+	assert.Error(t, err)
+}
@@ -9,34 +9,51 @@ import (
 )
 
 type CFAPI interface {
-	CreateChangeSet(params *cf.CreateChangeSetInput) (*cf.CreateChangeSetOutput, error)
-	DescribeChangeSet(params *cf.DescribeChangeSetInput) (*cf.DescribeChangeSetOutput, error)
-	DescribeStacks(params *cf.DescribeStacksInput) (*cf.DescribeStacksOutput, error)
-	DeleteChangeSet(params *cf.DeleteChangeSetInput) (*cf.DeleteChangeSetOutput, error)
-	GetTemplate(params *cf.GetTemplateInput) (*cf.GetTemplateOutput, error)
+	CreateChangeSet(ctx context.Context, params *cf.CreateChangeSetInput) (*cf.CreateChangeSetOutput, error)
+	DescribeChangeSet(ctx context.Context, params *cf.DescribeChangeSetInput) (*cf.DescribeChangeSetOutput, error)
+	DescribeStacks(ctx context.Context, params *cf.DescribeStacksInput) (*cf.DescribeStacksOutput, error)
+	DeleteChangeSet(ctx context.Context, params *cf.DeleteChangeSetInput) (*cf.DeleteChangeSetOutput, error)
+	DeleteStack(ctx context.Context, params *cf.DeleteStackInput) (*cf.DeleteStackOutput, error)
+	GetTemplate(ctx context.Context, params *cf.GetTemplateInput) (*cf.GetTemplateOutput, error)
 }
 type CFClient struct {
 	*cf.Client
 }
 
-func (client CFClient) CreateChangeSet(params *cf.CreateChangeSetInput) (*cf.CreateChangeSetOutput, error) {
-	return client.Client.CreateChangeSet(context.TODO(), params)
+func (client CFClient) CreateChangeSet(ctx context.Context, params *cf.CreateChangeSetInput) (*cf.CreateChangeSetOutput, error) {
+	return client.Client.CreateChangeSet(ctx, params)
 }
-func (client CFClient) DescribeStacks(params *cf.DescribeStacksInput) (*cf.DescribeStacksOutput, error) {
-	return client.Client.DescribeStacks(context.TODO(), params)
+func (client CFClient) DescribeStacks(ctx context.Context, params *cf.DescribeStacksInput) (*cf.DescribeStacksOutput, error) {
+	return client.Client.DescribeStacks(ctx, params)
 }
-func (client CFClient) GetTemplate(params *cf.GetTemplateInput) (*cf.GetTemplateOutput, error) {
-	return client.Client.GetTemplate(context.TODO(), params)
+func (client CFClient) GetTemplate(ctx context.Context, params *cf.GetTemplateInput) (*cf.GetTemplateOutput, error) {
+	return client.Client.GetTemplate(ctx, params)
 }
-func (client CFClient) DescribeChangeSet(params *cf.DescribeChangeSetInput) (*cf.DescribeChangeSetOutput, error) {
-	return client.Client.DescribeChangeSet(context.TODO(), params)
+func (client CFClient) DescribeChangeSet(ctx context.Context, params *cf.DescribeChangeSetInput) (*cf.DescribeChangeSetOutput, error) {
+	return client.Client.DescribeChangeSet(ctx, params)
 }
-func (client CFClient) DeleteChangeSet(params *cf.DeleteChangeSetInput) (*cf.DeleteChangeSetOutput, error) {
-	return client.Client.DeleteChangeSet(context.TODO(), params)
+func (client CFClient) DeleteChangeSet(ctx context.Context, params *cf.DeleteChangeSetInput) (*cf.DeleteChangeSetOutput, error) {
+	return client.Client.DeleteChangeSet(ctx, params)
+}
+func (client CFClient) DeleteStack(ctx context.Context, params *cf.DeleteStackInput) (*cf.DeleteStackOutput, error) {
+	return client.Client.DeleteStack(ctx, params)
 }
 
 func NewCFClient() (*CFClient, error) {
-	awsCfg, err := config.LoadDefaultConfig(context.TODO())
+	return NewCFClientFor("", "")
+}
+
+// NewCFClientFor creates a client for a region and a profile of the shared
+// configuration, the empty ones are read from the default configuration
+func NewCFClientFor(region string, profile string) (*CFClient, error) {
+	var optFns []func(*config.LoadOptions) error
+	if region != "" {
+		optFns = append(optFns, config.WithRegion(region))
+	}
+	if profile != "" {
+		optFns = append(optFns, config.WithSharedConfigProfile(profile))
+	}
+	awsCfg, err := config.LoadDefaultConfig(context.TODO(), optFns...)
 	if err != nil {
 		return nil, err
 	}
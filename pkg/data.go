@@ -2,6 +2,9 @@ package pkg
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -9,34 +12,75 @@ import (
 	cfTypes "github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
 )
 
-func ParameterListFromString(parametersString string) []cfTypes.Parameter {
+// ParameterListFromString parses parameters like "Key1=Value1 Key2=Value2".
+// The entries are split on whitespace like a shell does, with quotes and
+// backslash escapes, so that 'Key="a b"' is the value a b, and the value is
+// everything after the first =.
+func ParameterListFromString(parametersString string) ([]cfTypes.Parameter, error) {
+	keyValues, err := keyValuesFromString(parametersString)
+	if err != nil {
+		return nil, fmt.Errorf("invalid parameters: %w", err)
+	}
 	var parameterList []cfTypes.Parameter
-	for _, keyValue := range strings.Split(parametersString, " ") {
-		p := strings.Split(keyValue, "=")
-		if len(p) != 2 {
-			continue
+	for _, kv := range keyValues {
+		parameterList = MergeParameters(parameterList, []cfTypes.Parameter{{
+			ParameterKey:   aws.String(kv[0]),
+			ParameterValue: aws.String(kv[1]),
+		}})
+	}
+	return parameterList, nil
+}
+
+// TagListFromString parses tags like "Key1=Value1 Key2=Value2", the same
+// way of ParameterListFromString
+func TagListFromString(tagsString string) ([]cfTypes.Tag, error) {
+	keyValues, err := keyValuesFromString(tagsString)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tags: %w", err)
+	}
+	var tagList []cfTypes.Tag
+	for _, kv := range keyValues {
+		tagList = MergeTags(tagList, []cfTypes.Tag{{
+			Key:   aws.String(kv[0]),
+			Value: aws.String(kv[1]),
+		}})
+	}
+	return tagList, nil
+}
+
+func keyValuesFromString(s string) ([][2]string, error) {
+	entries, err := SplitCommandLine(s)
+	if err != nil {
+		return nil, err
+	}
+	var keyValues [][2]string
+	for _, entry := range entries {
+		kv := strings.SplitN(entry, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("expected Key=Value, found %q", entry)
 		}
-		parameterList = append(parameterList, cfTypes.Parameter{
-			ParameterKey:   &p[0],
-			ParameterValue: &p[1],
-		})
+		keyValues = append(keyValues, [2]string{kv[0], kv[1]})
 	}
-	return parameterList
+	return keyValues, nil
 }
 
-func TagListFromString(tagsString string) []cfTypes.Tag {
-	var parameterList []cfTypes.Tag
-	for _, keyValue := range strings.Split(tagsString, " ") {
-		p := strings.Split(keyValue, "=")
-		if len(p) != 2 {
-			continue
+// ResourcesToImportFromJson reads the resources to import in the same format of
+// the AWS CLI --resources-to-import option:
+// [{"ResourceType":"AWS::S3::Bucket","LogicalResourceId":"Bucket","ResourceIdentifier":{"BucketName":"my-bucket"}}]
+func ResourcesToImportFromJson(data []byte) ([]cfTypes.ResourceToImport, error) {
+	var resources []cfTypes.ResourceToImport
+	if err := json.Unmarshal(data, &resources); err != nil {
+		return nil, fmt.Errorf("cannot read the resources to import: %w", err)
+	}
+	if len(resources) == 0 {
+		return nil, errors.New("no resources to import")
+	}
+	for i, r := range resources {
+		if r.LogicalResourceId == nil || r.ResourceType == nil || len(r.ResourceIdentifier) == 0 {
+			return nil, fmt.Errorf("resource to import #%d: LogicalResourceId, ResourceType and ResourceIdentifier are required", i+1)
 		}
-		parameterList = append(parameterList, cfTypes.Tag{
-			Key:   &p[0],
-			Value: &p[1],
-		})
 	}
-	return parameterList
+	return resources, nil
 }
 
 func OverrideParameters(stackParameters []cfTypes.Parameter, inputParameters []cfTypes.Parameter) ([]cfTypes.Parameter, error) {
@@ -69,12 +113,124 @@ func OverrideParameters(stackParameters []cfTypes.Parameter, inputParameters []c
 }
 
 type GiffChange struct {
-	Action             cfTypes.ChangeAction
-	LogicalResourceId  *string
-	PhysicalResourceId *string
-	Replacement        cfTypes.Replacement
-	ResourceType       *string
-	Scope              []cfTypes.ResourceAttribute
+	Action             cfTypes.ChangeAction        `json:"action"`
+	LogicalResourceId  *string                     `json:"logicalResourceId"`
+	PhysicalResourceId *string                     `json:"physicalResourceId"`
+	Replacement        cfTypes.Replacement         `json:"replacement"`
+	ResourceType       *string                     `json:"resourceType"`
+	Scope              []cfTypes.ResourceAttribute `json:"scope"`
+	Details            []GiffChangeDetail          `json:"details"`
+	ChangeSetId        *string                     `json:"changeSetId,omitempty"`
+	NestedChanges      []GiffChange                `json:"nestedChanges,omitempty"`
+}
+
+const nestedStackResourceType = "AWS::CloudFormation::Stack"
+
+// IsNestedStack tells if the change is about a nested stack with its own changeset
+func (c GiffChange) IsNestedStack() bool {
+	return c.ResourceType != nil && *c.ResourceType == nestedStackResourceType && c.ChangeSetId != nil
+}
+
+// GiffChangeDetail describes the change of a single resource property or
+// attribute and what caused it
+type GiffChangeDetail struct {
+	Attribute          cfTypes.ResourceAttribute  `json:"attribute"`
+	Name               *string                    `json:"name"`
+	RequiresRecreation cfTypes.RequiresRecreation `json:"requiresRecreation"`
+	ChangeSource       cfTypes.ChangeSource       `json:"changeSource"`
+	CausingEntity      *string                    `json:"causingEntity"`
+	Evaluation         cfTypes.EvaluationType     `json:"evaluation"`
+}
+
+// ChangesReportSchemaVersion is the version of the ChangesReport JSON schema.
+// Bump it on every incompatible change of the JSON output.
+const ChangesReportSchemaVersion = 1
+
+// ChangesReport is the machine readable form of the changes of a changeset
+type ChangesReport struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	StackName     *string         `json:"stackName"`
+	ChangeSetArn  *string         `json:"changeSetArn"`
+	Changes       []GiffChange    `json:"changes"`
+	Parameters    []GiffParameter `json:"parameters"`
+}
+
+func NewChangesReport(describeChangeSetOutput *cf.DescribeChangeSetOutput, changes []GiffChange, parameters []GiffParameter) ChangesReport {
+	if changes == nil {
+		changes = make([]GiffChange, 0)
+	}
+	if parameters == nil {
+		parameters = make([]GiffParameter, 0)
+	}
+	return ChangesReport{
+		SchemaVersion: ChangesReportSchemaVersion,
+		StackName:     describeChangeSetOutput.StackName,
+		ChangeSetArn:  describeChangeSetOutput.ChangeSetId,
+		Changes:       changes,
+		Parameters:    parameters,
+	}
+}
+
+// GiffParameter is a parameter of a changeset, PreviousValue is nil for the
+// parameters added by the changeset and NewValue for the removed ones
+type GiffParameter struct {
+	Key           string  `json:"key"`
+	PreviousValue *string `json:"previousValue"`
+	NewValue      *string `json:"newValue"`
+	Overridden    bool    `json:"overridden"`
+}
+
+// Changed tells if the changeset adds, removes or modifies the parameter
+func (p GiffParameter) Changed() bool {
+	return aws.ToString(p.PreviousValue) != aws.ToString(p.NewValue) || (p.PreviousValue == nil) != (p.NewValue == nil)
+}
+
+// NewGiffParameters returns the parameters of the stack and of the changeset
+// sorted by key. overridden are the keys of the values given with the
+// changeset, when it's nil (an existing changeset) a parameter is overridden
+// if its value changed. The values of the NoEcho parameters of the template
+// are redacted, CloudFormation already redacts the ones of the stack.
+func NewGiffParameters(stackParameters []cfTypes.Parameter, changeSetParameters []cfTypes.Parameter, overridden map[string]bool, template Template) []GiffParameter {
+	parameters := map[string]*GiffParameter{}
+	parameter := func(key string) *GiffParameter {
+		if parameters[key] == nil {
+			parameters[key] = &GiffParameter{Key: key}
+		}
+		return parameters[key]
+	}
+	for _, p := range stackParameters {
+		parameter(aws.ToString(p.ParameterKey)).PreviousValue = p.ParameterValue
+	}
+	for _, p := range changeSetParameters {
+		parameter(aws.ToString(p.ParameterKey)).NewValue = p.ParameterValue
+	}
+
+	var keys []string
+	for key := range parameters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	declarations, _ := template["Parameters"].(map[string]interface{})
+	var list []GiffParameter
+	for _, key := range keys {
+		p := *parameters[key]
+		if overridden != nil {
+			p.Overridden = overridden[key]
+		} else {
+			p.Overridden = p.Changed()
+		}
+		if declaration, ok := declarations[key].(map[string]interface{}); ok && declaration["NoEcho"] == "true" {
+			if p.PreviousValue != nil {
+				p.PreviousValue = aws.String(NoEchoMask)
+			}
+			if p.NewValue != nil {
+				p.NewValue = aws.String(NoEchoMask)
+			}
+		}
+		list = append(list, p)
+	}
+	return list
 }
 
 func PrettyJson(i interface{}) string {
@@ -98,7 +254,26 @@ func ExtractChanges(describeChangeSetOutput *cf.DescribeChangeSetOutput) ([]Giff
 		change.Replacement = c.ResourceChange.Replacement
 		change.ResourceType = c.ResourceChange.ResourceType
 		change.Scope = c.ResourceChange.Scope
+		change.Details = extractDetails(c.ResourceChange.Details)
+		change.ChangeSetId = c.ResourceChange.ChangeSetId
 		changes = append(changes, change)
 	}
 	return changes, nil
 }
+
+func extractDetails(resourceChangeDetails []cfTypes.ResourceChangeDetail) []GiffChangeDetail {
+	details := make([]GiffChangeDetail, 0, len(resourceChangeDetails))
+	for _, d := range resourceChangeDetails {
+		var detail GiffChangeDetail
+		if d.Target != nil {
+			detail.Attribute = d.Target.Attribute
+			detail.Name = d.Target.Name
+			detail.RequiresRecreation = d.Target.RequiresRecreation
+		}
+		detail.ChangeSource = d.ChangeSource
+		detail.CausingEntity = d.CausingEntity
+		detail.Evaluation = d.Evaluation
+		details = append(details, detail)
+	}
+	return details
+}
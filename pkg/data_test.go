@@ -12,7 +12,8 @@ import (
 )
 
 func TestParameterListFromString(t *testing.T) {
-	list := ParameterListFromString("p1=v1 p2=v2")
+	list, err := ParameterListFromString("p1=v1 p2=v2")
+	assert.NoError(t, err)
 	assert.Exactly(t,
 		[]cfTypes.Parameter{
 			{
@@ -25,7 +26,42 @@ func TestParameterListFromString(t *testing.T) {
 			},
 		},
 		list)
+
+	list, err = ParameterListFromString(` Filter=a=b  Name='a b' List="x, y" Escaped=c\ d Empty= p1=old p1=new`)
+	assert.NoError(t, err)
+	assert.Exactly(t,
+		[]cfTypes.Parameter{
+			{ParameterKey: aws.String("Filter"), ParameterValue: aws.String("a=b")},
+			{ParameterKey: aws.String("Name"), ParameterValue: aws.String("a b")},
+			{ParameterKey: aws.String("List"), ParameterValue: aws.String("x, y")},
+			{ParameterKey: aws.String("Escaped"), ParameterValue: aws.String("c d")},
+			{ParameterKey: aws.String("Empty"), ParameterValue: aws.String("")},
+			{ParameterKey: aws.String("p1"), ParameterValue: aws.String("new")},
+		},
+		list)
+
+	_, err = ParameterListFromString("p1=v1 p2")
+	assert.EqualError(t, err, "invalid parameters: expected Key=Value, found \"p2\"")
+	_, err = ParameterListFromString("=v1")
+	assert.EqualError(t, err, "invalid parameters: expected Key=Value, found \"=v1\"")
+	_, err = ParameterListFromString("p1='v1")
+	assert.EqualError(t, err, "invalid parameters: unterminated ' quote in \"p1='v1\"")
+}
+
+func TestTagListFromString(t *testing.T) {
+	list, err := TagListFromString("team=ops 'cost center=a b'")
+	assert.NoError(t, err)
+	assert.Exactly(t,
+		[]cfTypes.Tag{
+			{Key: aws.String("team"), Value: aws.String("ops")},
+			{Key: aws.String("cost center"), Value: aws.String("a b")},
+		},
+		list)
+
+	_, err = TagListFromString("team")
+	assert.EqualError(t, err, "invalid tags: expected Key=Value, found \"team\"")
 }
+
 func TestOverrideParameters(t *testing.T) {
 	stackParametersList :=
 		[]cfTypes.Parameter{
@@ -123,6 +159,14 @@ func TestExtractChanges_Tag(t *testing.T) {
 				Replacement:        cfTypes.ReplacementFalse,
 				ResourceType:       &ResourceType,
 				Scope:              []cfTypes.ResourceAttribute{"Tags"},
+				Details: []GiffChangeDetail{
+					{
+						Attribute:          cfTypes.ResourceAttributeTags,
+						RequiresRecreation: cfTypes.RequiresRecreationNever,
+						ChangeSource:       cfTypes.ChangeSourceDirectModification,
+						Evaluation:         cfTypes.EvaluationTypeStatic,
+					},
+				},
 			},
 		},
 		"error",
@@ -149,6 +193,21 @@ func TestExtractChanges_Parameter(t *testing.T) {
 				Replacement:        cfTypes.ReplacementFalse,
 				ResourceType:       &ResourceType,
 				Scope:              []cfTypes.ResourceAttribute{"Tags"},
+				Details: []GiffChangeDetail{
+					{
+						Attribute:          cfTypes.ResourceAttributeTags,
+						RequiresRecreation: cfTypes.RequiresRecreationNever,
+						ChangeSource:       cfTypes.ChangeSourceDirectModification,
+						Evaluation:         cfTypes.EvaluationTypeDynamic,
+					},
+					{
+						Attribute:          cfTypes.ResourceAttributeTags,
+						RequiresRecreation: cfTypes.RequiresRecreationNever,
+						ChangeSource:       cfTypes.ChangeSourceParameterReference,
+						CausingEntity:      aws.String("Purpose"),
+						Evaluation:         cfTypes.EvaluationTypeStatic,
+					},
+				},
 			},
 		},
 		changes,
@@ -176,6 +235,51 @@ func TestExtractChanges_Replacement(t *testing.T) {
 				Replacement:        cfTypes.ReplacementTrue,
 				ResourceType:       &ResourceType,
 				Scope:              []cfTypes.ResourceAttribute{"Tags", "Properties"},
+				Details: []GiffChangeDetail{
+					{
+						Attribute:          cfTypes.ResourceAttributeProperties,
+						Name:               aws.String("KeyName"),
+						RequiresRecreation: cfTypes.RequiresRecreationAlways,
+						ChangeSource:       cfTypes.ChangeSourceDirectModification,
+						Evaluation:         cfTypes.EvaluationTypeDynamic,
+					},
+					{
+						Attribute:          cfTypes.ResourceAttributeProperties,
+						Name:               aws.String("InstanceType"),
+						RequiresRecreation: cfTypes.RequiresRecreationConditionally,
+						ChangeSource:       cfTypes.ChangeSourceDirectModification,
+						Evaluation:         cfTypes.EvaluationTypeDynamic,
+					},
+					{
+						Attribute:          cfTypes.ResourceAttributeTags,
+						RequiresRecreation: cfTypes.RequiresRecreationNever,
+						ChangeSource:       cfTypes.ChangeSourceDirectModification,
+						Evaluation:         cfTypes.EvaluationTypeDynamic,
+					},
+					{
+						Attribute:          cfTypes.ResourceAttributeProperties,
+						Name:               aws.String("KeyName"),
+						RequiresRecreation: cfTypes.RequiresRecreationAlways,
+						ChangeSource:       cfTypes.ChangeSourceParameterReference,
+						CausingEntity:      aws.String("KeyPairName"),
+						Evaluation:         cfTypes.EvaluationTypeStatic,
+					},
+					{
+						Attribute:          cfTypes.ResourceAttributeProperties,
+						Name:               aws.String("InstanceType"),
+						RequiresRecreation: cfTypes.RequiresRecreationConditionally,
+						ChangeSource:       cfTypes.ChangeSourceParameterReference,
+						CausingEntity:      aws.String("InstanceType"),
+						Evaluation:         cfTypes.EvaluationTypeStatic,
+					},
+					{
+						Attribute:          cfTypes.ResourceAttributeTags,
+						RequiresRecreation: cfTypes.RequiresRecreationNever,
+						ChangeSource:       cfTypes.ChangeSourceParameterReference,
+						CausingEntity:      aws.String("Purpose"),
+						Evaluation:         cfTypes.EvaluationTypeStatic,
+					},
+				},
 			},
 		},
 		changes,
@@ -200,6 +304,7 @@ func TestExtractChanges_AddAndRemove(t *testing.T) {
 				Replacement:        "",
 				ResourceType:       aws.String("AWS::AutoScaling::AutoScalingGroup"),
 				Scope:              []cfTypes.ResourceAttribute{},
+				Details:            []GiffChangeDetail{},
 			},
 			{
 				Action:             cfTypes.ChangeActionAdd,
@@ -208,6 +313,7 @@ func TestExtractChanges_AddAndRemove(t *testing.T) {
 				Replacement:        "",
 				ResourceType:       aws.String("AWS::AutoScaling::LaunchConfiguration"),
 				Scope:              []cfTypes.ResourceAttribute{},
+				Details:            []GiffChangeDetail{},
 			},
 			{
 				Action:             cfTypes.ChangeActionRemove,
@@ -216,9 +322,62 @@ func TestExtractChanges_AddAndRemove(t *testing.T) {
 				Replacement:        "",
 				ResourceType:       aws.String("AWS::EC2::Instance"),
 				Scope:              []cfTypes.ResourceAttribute{},
+				Details:            []GiffChangeDetail{},
 			},
 		},
 		changes,
 		"error",
 	)
 }
+
+func TestResourcesToImportFromJson(t *testing.T) {
+	resources, err := ResourcesToImportFromJson([]byte(`[
+		{"ResourceType": "AWS::S3::Bucket", "LogicalResourceId": "Bucket", "ResourceIdentifier": {"BucketName": "my-bucket"}}
+	]`))
+	assert.NoError(t, err)
+	assert.Exactly(t,
+		[]cfTypes.ResourceToImport{
+			{
+				LogicalResourceId:  aws.String("Bucket"),
+				ResourceIdentifier: map[string]string{"BucketName": "my-bucket"},
+				ResourceType:       aws.String("AWS::S3::Bucket"),
+			},
+		},
+		resources)
+
+	_, err = ResourcesToImportFromJson([]byte(`[{"ResourceType": "AWS::S3::Bucket", "LogicalResourceId": "Bucket"}]`))
+	assert.EqualError(t, err, "resource to import #1: LogicalResourceId, ResourceType and ResourceIdentifier are required")
+
+	_, err = ResourcesToImportFromJson([]byte(`[]`))
+	assert.EqualError(t, err, "no resources to import")
+}
+
+func TestNewGiffParameters(t *testing.T) {
+	template, err := ParseTemplate([]byte("Parameters:\n  Password: {Type: String, NoEcho: true}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stackParameters := []cfTypes.Parameter{
+		{ParameterKey: aws.String("Env"), ParameterValue: aws.String("prod")},
+		{ParameterKey: aws.String("Size"), ParameterValue: aws.String("1")},
+	}
+	changeSetParameters := []cfTypes.Parameter{
+		{ParameterKey: aws.String("Env"), ParameterValue: aws.String("prod")},
+		{ParameterKey: aws.String("Size"), ParameterValue: aws.String("2")},
+		{ParameterKey: aws.String("Password"), ParameterValue: aws.String("secret")},
+	}
+	assert.Exactly(t,
+		[]GiffParameter{
+			{Key: "Env", PreviousValue: aws.String("prod"), NewValue: aws.String("prod")},
+			{Key: "Password", NewValue: aws.String(NoEchoMask), Overridden: true},
+			{Key: "Size", PreviousValue: aws.String("1"), NewValue: aws.String("2"), Overridden: true},
+		},
+		NewGiffParameters(stackParameters, changeSetParameters, nil, template))
+	assert.Exactly(t,
+		[]GiffParameter{
+			{Key: "Env", PreviousValue: aws.String("prod"), NewValue: aws.String("prod"), Overridden: true},
+			{Key: "Password", NewValue: aws.String("secret")},
+			{Key: "Size", PreviousValue: aws.String("1"), NewValue: aws.String("2")},
+		},
+		NewGiffParameters(stackParameters, changeSetParameters, map[string]bool{"Env": true}, nil))
+}
@@ -10,30 +10,28 @@
 package pkg
 
 import (
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
 )
 
-// Returns diff of two arrays of bytes in diff tool format.
-func Diff(prefix string, cmd string, b1, b2 []byte) ([]byte, error) {
-	f1, err := writeTempFile(prefix, b1)
+// Diff runs an external diff command over b1 and b2 and returns its output.
+// The command line can use the {old} and {new} placeholders for the names
+// of the files, like "difft {old} {new}", otherwise the files are appended
+// to it. A single command name is run as "cmd -u old new". The files are
+// created in a temporary directory with the given names.
+func Diff(commandLine string, oldName string, newName string, b1, b2 []byte) ([]byte, error) {
+	args, cleanup, err := prepareDiff(commandLine, oldName, newName, b1, b2)
 	if err != nil {
 		return nil, err
 	}
-	defer os.Remove(f1)
+	defer cleanup()
 
-	f2, err := writeTempFile(prefix, b2)
-	if err != nil {
-		return nil, err
-	}
-	defer os.Remove(f2)
-
-	if cmd == "" {
-		cmd = "diff"
-	}
-
-	data, err := exec.Command(cmd, "-u", f1, f2).CombinedOutput()
+	data, err := exec.Command(args[0], args[1:]...).CombinedOutput()
 	if len(data) > 0 {
 		// diff exits with a non-zero status when the files don't match.
 		// Ignore that failure as long as we get output.
@@ -42,18 +40,133 @@ func Diff(prefix string, cmd string, b1, b2 []byte) ([]byte, error) {
 	return data, err
 }
 
-func writeTempFile(prefix string, data []byte) (string, error) {
-	file, err := ioutil.TempFile("", prefix)
+// DiffInteractive is like Diff but the command is attached to the terminal,
+// for tools like vimdiff. The exit status of the command is ignored.
+func DiffInteractive(commandLine string, oldName string, newName string, b1, b2 []byte) error {
+	args, cleanup, err := prepareDiff(commandLine, oldName, newName, b1, b2)
 	if err != nil {
-		return "", err
+		return err
 	}
-	_, err = file.Write(data)
-	if err1 := file.Close(); err == nil {
-		err = err1
+	defer cleanup()
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err = cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return nil
 	}
+	return err
+}
+
+func prepareDiff(commandLine string, oldName string, newName string, b1, b2 []byte) (args []string, cleanup func(), err error) {
+	if commandLine == "" {
+		commandLine = "diff"
+	}
+	args, err = SplitCommandLine(commandLine)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(args) == 0 {
+		return nil, nil, errors.New("empty diff command")
+	}
+
+	dir, err := ioutil.TempDir("", "giff")
 	if err != nil {
-		os.Remove(file.Name())
-		return "", err
+		return nil, nil, err
+	}
+	cleanup = func() { os.RemoveAll(dir) }
+	oldName = tempFileName(oldName, "old")
+	newName = tempFileName(newName, "new")
+	if oldName == newName {
+		newName = "new-" + newName
+	}
+	f1 := filepath.Join(dir, oldName)
+	f2 := filepath.Join(dir, newName)
+	if err = ioutil.WriteFile(f1, b1, 0600); err == nil {
+		err = ioutil.WriteFile(f2, b2, 0600)
+	}
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+
+	return diffArgs(args, f1, f2), cleanup, nil
+}
+
+// diffArgs replaces the {old} and {new} placeholders with the file names
+func diffArgs(args []string, f1 string, f2 string) []string {
+	placeholders := false
+	for i, arg := range args {
+		if strings.Contains(arg, "{old}") || strings.Contains(arg, "{new}") {
+			placeholders = true
+			args[i] = strings.ReplaceAll(strings.ReplaceAll(arg, "{old}", f1), "{new}", f2)
+		}
+	}
+	if placeholders {
+		return args
+	}
+	if len(args) == 1 {
+		return append(args, "-u", f1, f2)
+	}
+	return append(args, f1, f2)
+}
+
+// tempFileName returns a file name without path separators
+func tempFileName(name string, defaultName string) string {
+	name = strings.NewReplacer("/", "_", "\\", "_", ":", "_").Replace(name)
+	if name == "" || name == "." || name == ".." {
+		return defaultName
+	}
+	return name
+}
+
+// SplitCommandLine splits a command line in arguments like a shell does with
+// spaces, single quotes, double quotes and backslash escapes
+func SplitCommandLine(commandLine string) ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	inArg := false
+	var quote rune
+	escaped := false
+	for _, r := range commandLine {
+		switch {
+		case escaped:
+			arg.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inArg = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				arg.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote in %q", quote, commandLine)
+	}
+	if escaped {
+		return nil, fmt.Errorf("unterminated escape in %q", commandLine)
+	}
+	if inArg {
+		args = append(args, arg.String())
 	}
-	return file.Name(), nil
+	return args, nil
 }
@@ -0,0 +1,51 @@
+package pkg
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitCommandLine(t *testing.T) {
+	tests := []struct {
+		commandLine string
+		args        []string
+	}{
+		{"diff", []string{"diff"}},
+		{"  git diff  --no-index {old}\t{new} ", []string{"git", "diff", "--no-index", "{old}", "{new}"}},
+		{`dyff between --set-exit-code "{old}" '{new}'`, []string{"dyff", "between", "--set-exit-code", "{old}", "{new}"}},
+		{`cmd "a b" 'c "d"' e\ f ""`, []string{"cmd", "a b", `c "d"`, "e f", ""}},
+		{`cmd 'a\b' "a\"b"`, []string{"cmd", `a\b`, `a"b`}},
+	}
+	for _, test := range tests {
+		args, err := SplitCommandLine(test.commandLine)
+		assert.NoError(t, err, test.commandLine)
+		assert.Equal(t, test.args, args, test.commandLine)
+	}
+
+	_, err := SplitCommandLine(`diff "a`)
+	assert.EqualError(t, err, `unterminated " quote in "diff \"a"`)
+}
+
+func TestDiffArgs(t *testing.T) {
+	assert.Equal(t, []string{"diff", "-u", "f1", "f2"}, diffArgs([]string{"diff"}, "f1", "f2"))
+	assert.Equal(t, []string{"git", "diff", "--no-index", "f1", "f2"}, diffArgs([]string{"git", "diff", "--no-index"}, "f1", "f2"))
+	assert.Equal(t, []string{"tool", "--left=f1", "f2"}, diffArgs([]string{"tool", "--left={old}", "{new}"}, "f1", "f2"))
+}
+
+func TestDiff_placeholders(t *testing.T) {
+	out, err := Diff("echo {new} {old}", "stack.deployed.yaml", "template.local.yaml", []byte("a"), []byte("b"))
+	assert.NoError(t, err)
+	files := strings.Fields(string(out))
+	assert.Len(t, files, 2)
+	assert.Equal(t, "template.local.yaml", filepath.Base(files[0]))
+	assert.Equal(t, "stack.deployed.yaml", filepath.Base(files[1]))
+}
+
+func TestDiff_exit_status(t *testing.T) {
+	out, err := Diff("diff", "old.yaml", "new.yaml", []byte("a\n"), []byte("b\n"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(out), "-a\n+b\n")
+}
@@ -0,0 +1,169 @@
+package pkg
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// IgnorePattern is a path pattern of the template values to ignore, like
+// Resources.*.Metadata or Resources.MyFunction.Properties.Layers[*]. The
+// key segments are matched like path.Match, the list indexes are [n] or [*].
+type IgnorePattern []string
+
+// ParseIgnorePattern parses a path pattern
+func ParseIgnorePattern(s string) (IgnorePattern, error) {
+	segments, err := splitPath(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ignore pattern %q: %w", s, err)
+	}
+	for _, segment := range segments {
+		if isIndexSegment(segment) {
+			if segment != "[*]" {
+				if _, err := strconv.Atoi(segment[1 : len(segment)-1]); err != nil {
+					return nil, fmt.Errorf("invalid ignore pattern %q: invalid index %s", s, segment)
+				}
+			}
+		} else if _, err := path.Match(segment, ""); err != nil {
+			return nil, fmt.Errorf("invalid ignore pattern %q: %w", s, err)
+		}
+	}
+	return segments, nil
+}
+
+// ParseIgnoreFile reads the patterns of an ignore file, one per line. Empty
+// lines and lines starting with # are skipped.
+func ParseIgnoreFile(data []byte) ([]IgnorePattern, error) {
+	var patterns []IgnorePattern
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		pattern, err := ParseIgnorePattern(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, scanner.Err()
+}
+
+// splitPath splits a path like Resources.R.Properties.L[1] in its segments:
+// Resources, R, Properties, L, [1]
+func splitPath(s string) ([]string, error) {
+	var segments []string
+	for _, part := range strings.Split(s, ".") {
+		if part == "" {
+			return nil, errors.New("empty path segment")
+		}
+		for part != "" {
+			i := strings.Index(part, "[")
+			switch {
+			case i < 0:
+				i = len(part)
+			case i == 0:
+				i = strings.Index(part, "]") + 1
+				if i == 0 {
+					return nil, errors.New("missing ]")
+				}
+			}
+			segments = append(segments, part[:i])
+			part = part[i:]
+		}
+	}
+	return segments, nil
+}
+
+func isIndexSegment(segment string) bool {
+	return strings.HasPrefix(segment, "[")
+}
+
+// matches tells if the pattern matches the path segments
+func (p IgnorePattern) matches(segments []string) bool {
+	if len(p) != len(segments) {
+		return false
+	}
+	for i, pattern := range p {
+		switch {
+		case pattern == segments[i], pattern == "[*]" && isIndexSegment(segments[i]):
+		case isIndexSegment(pattern) || isIndexSegment(segments[i]):
+			return false
+		default:
+			if ok, _ := path.Match(pattern, segments[i]); !ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func ignored(segments []string, patterns []IgnorePattern) bool {
+	for _, p := range patterns {
+		if p.matches(segments) {
+			return true
+		}
+	}
+	return false
+}
+
+// RemoveIgnored removes the values matched by the patterns from the
+// template
+func RemoveIgnored(template Template, patterns []IgnorePattern) {
+	if len(patterns) > 0 {
+		removeIgnored(map[string]interface{}(template), nil, patterns)
+	}
+}
+
+func removeIgnored(value interface{}, segments []string, patterns []IgnorePattern) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for k, item := range v {
+			s := append(segments[:len(segments):len(segments)], k)
+			if ignored(s, patterns) {
+				delete(v, k)
+				continue
+			}
+			v[k] = removeIgnored(item, s, patterns)
+		}
+	case []interface{}:
+		kept := v[:0]
+		for i, item := range v {
+			s := append(segments[:len(segments):len(segments)], fmt.Sprintf("[%d]", i))
+			if ignored(s, patterns) {
+				continue
+			}
+			kept = append(kept, removeIgnored(item, s, patterns))
+		}
+		return kept
+	}
+	return value
+}
+
+// RemoveIgnoredChanges returns the changes whose path is not matched by the
+// patterns, or inside a value matched by them
+func RemoveIgnoredChanges(changes []TemplateChange, patterns []IgnorePattern) []TemplateChange {
+	var kept []TemplateChange
+	for _, c := range changes {
+		segments, err := splitPath(c.Path)
+		if err == nil && ignoredSubtree(segments, patterns) {
+			continue
+		}
+		kept = append(kept, c)
+	}
+	return kept
+}
+
+func ignoredSubtree(segments []string, patterns []IgnorePattern) bool {
+	for i := 1; i <= len(segments); i++ {
+		if ignored(segments[:i], patterns) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+package pkg
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseIgnorePattern(t *testing.T) {
+	tests := []struct {
+		s       string
+		pattern IgnorePattern
+		ok      bool
+	}{
+		{"Description", IgnorePattern{"Description"}, true},
+		{"Resources.*.Metadata", IgnorePattern{"Resources", "*", "Metadata"}, true},
+		{"Resources.F.Properties.Layers[*]", IgnorePattern{"Resources", "F", "Properties", "Layers", "[*]"}, true},
+		{"Resources.F.Properties.Layers[1].Name", IgnorePattern{"Resources", "F", "Properties", "Layers", "[1]", "Name"}, true},
+		{"", nil, false},
+		{"Resources..Metadata", nil, false},
+		{"Resources.", nil, false},
+		{"Resources.F.L[1", nil, false},
+		{"Resources.F.L[x]", nil, false},
+		{"Resources.[a-", nil, false},
+	}
+	for _, test := range tests {
+		pattern, err := ParseIgnorePattern(test.s)
+		if !test.ok {
+			assert.Error(t, err, test.s)
+			continue
+		}
+		assert.NoError(t, err, test.s)
+		assert.Equal(t, test.pattern, pattern, test.s)
+	}
+}
+
+func TestParseIgnoreFile(t *testing.T) {
+	patterns, err := ParseIgnoreFile([]byte("# comment\n\nDescription\n  Resources.*.Metadata  \n"))
+	assert.NoError(t, err)
+	assert.Equal(t, []IgnorePattern{{"Description"}, {"Resources", "*", "Metadata"}}, patterns)
+
+	_, err = ParseIgnoreFile([]byte("Description\nResources..Metadata\n"))
+	assert.EqualError(t, err, "line 2: invalid ignore pattern \"Resources..Metadata\": empty path segment")
+}
+
+func mustParseIgnorePatterns(t *testing.T, patterns ...string) []IgnorePattern {
+	var parsed []IgnorePattern
+	for _, s := range patterns {
+		p, err := ParseIgnorePattern(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed = append(parsed, p)
+	}
+	return parsed
+}
+
+func TestRemoveIgnored(t *testing.T) {
+	template, err := ParseTemplate([]byte(`
+Description: d
+Resources:
+  Role:
+    Type: AWS::IAM::Role
+    Metadata: {cfn-lint: {config: {ignore_checks: [W3005]}}}
+    Properties:
+      ManagedPolicyArns: [a, b, c]
+  Function:
+    Type: AWS::Lambda::Function
+    Metadata: m
+    Properties:
+      Layers: [x, y]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	RemoveIgnored(template, mustParseIgnorePatterns(t, "Description", "Resources.*.Metadata", "Resources.Role.Properties.ManagedPolicyArns[1]", "Resources.Func*.Properties.Layers[*]"))
+	assert.Equal(t, Template{
+		"Resources": map[string]interface{}{
+			"Role": map[string]interface{}{
+				"Type":       "AWS::IAM::Role",
+				"Properties": map[string]interface{}{"ManagedPolicyArns": []interface{}{"a", "c"}},
+			},
+			"Function": map[string]interface{}{
+				"Type":       "AWS::Lambda::Function",
+				"Properties": map[string]interface{}{"Layers": []interface{}{}},
+			},
+		},
+	}, template)
+}
+
+func TestRemoveIgnoredChanges(t *testing.T) {
+	changes := []TemplateChange{
+		{Kind: TemplateChangeModify, Section: "StackTags", Path: "StackTags.deployed-at"},
+		{Kind: TemplateChangeModify, Section: "StackTags", Path: "StackTags.team"},
+		{Kind: TemplateChangeModify, Section: "Resources", Path: "Resources.R.Metadata.x"},
+	}
+	assert.Equal(t, changes[1:2], RemoveIgnoredChanges(changes, mustParseIgnorePatterns(t, "StackTags.deployed-at", "Resources.*.Metadata")))
+}
@@ -0,0 +1,230 @@
+package pkg
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	cfTypes "github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
+)
+
+// codePipelineConfiguration is a CodePipeline template configuration file:
+// {"Parameters": {"Key": "Value"}, "Tags": {"Key": "Value"}}
+type codePipelineConfiguration struct {
+	Parameters map[string]string
+	Tags       map[string]string
+}
+
+// ParametersFromFile reads a parameters file in one of the formats:
+//   - the AWS CLI JSON: [{"ParameterKey": "Key", "ParameterValue": "Value"}]
+//   - the aws cloudformation deploy --parameter-overrides JSON: ["Key=Value"]
+//   - a CodePipeline template configuration: {"Parameters": {"Key": "Value"}}
+//   - Key=Value lines, like aws cloudformation deploy --parameter-overrides
+//
+// The parameters with UsePreviousValue are skipped, it's the default.
+func ParametersFromFile(data []byte) ([]cfTypes.Parameter, error) {
+	switch firstChar(data) {
+	case '[':
+		if keyValues, ok, err := readKeyValueList(data); ok {
+			if err != nil {
+				return nil, fmt.Errorf("cannot read the parameters: %w", err)
+			}
+			var list []cfTypes.Parameter
+			for _, kv := range keyValues {
+				list = append(list, cfTypes.Parameter{ParameterKey: aws.String(kv[0]), ParameterValue: aws.String(kv[1])})
+			}
+			return list, nil
+		}
+		var parameters []cfTypes.Parameter
+		if err := json.Unmarshal(data, &parameters); err != nil {
+			return nil, fmt.Errorf("cannot read the parameters: %w", err)
+		}
+		var list []cfTypes.Parameter
+		for i, p := range parameters {
+			if p.ParameterKey == nil {
+				return nil, fmt.Errorf("parameter #%d: ParameterKey is required", i+1)
+			}
+			if aws.ToBool(p.UsePreviousValue) {
+				continue
+			}
+			if p.ParameterValue == nil {
+				return nil, fmt.Errorf("parameter %s: ParameterValue is required", *p.ParameterKey)
+			}
+			list = append(list, cfTypes.Parameter{ParameterKey: p.ParameterKey, ParameterValue: p.ParameterValue})
+		}
+		return list, nil
+	case '{':
+		var configuration codePipelineConfiguration
+		if err := json.Unmarshal(data, &configuration); err != nil {
+			return nil, fmt.Errorf("cannot read the parameters: %w", err)
+		}
+		var list []cfTypes.Parameter
+		for _, k := range sortedStringKeys(configuration.Parameters) {
+			list = append(list, cfTypes.Parameter{ParameterKey: aws.String(k), ParameterValue: aws.String(configuration.Parameters[k])})
+		}
+		return list, nil
+	}
+	keyValues, err := readKeyValues(data)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read the parameters: %w", err)
+	}
+	var list []cfTypes.Parameter
+	for _, kv := range keyValues {
+		list = append(list, cfTypes.Parameter{ParameterKey: aws.String(kv[0]), ParameterValue: aws.String(kv[1])})
+	}
+	return list, nil
+}
+
+// TagsFromFile reads a tags file in one of the formats:
+//   - the AWS CLI JSON: [{"Key": "Key", "Value": "Value"}]
+//   - the aws cloudformation deploy --tags JSON: ["Key=Value"]
+//   - a CodePipeline template configuration: {"Tags": {"Key": "Value"}}
+//   - Key=Value lines
+func TagsFromFile(data []byte) ([]cfTypes.Tag, error) {
+	switch firstChar(data) {
+	case '[':
+		if keyValues, ok, err := readKeyValueList(data); ok {
+			if err != nil {
+				return nil, fmt.Errorf("cannot read the tags: %w", err)
+			}
+			var list []cfTypes.Tag
+			for _, kv := range keyValues {
+				list = append(list, cfTypes.Tag{Key: aws.String(kv[0]), Value: aws.String(kv[1])})
+			}
+			return list, nil
+		}
+		var tags []cfTypes.Tag
+		if err := json.Unmarshal(data, &tags); err != nil {
+			return nil, fmt.Errorf("cannot read the tags: %w", err)
+		}
+		for i, t := range tags {
+			if t.Key == nil || t.Value == nil {
+				return nil, fmt.Errorf("tag #%d: Key and Value are required", i+1)
+			}
+		}
+		return tags, nil
+	case '{':
+		var configuration codePipelineConfiguration
+		if err := json.Unmarshal(data, &configuration); err != nil {
+			return nil, fmt.Errorf("cannot read the tags: %w", err)
+		}
+		var list []cfTypes.Tag
+		for _, k := range sortedStringKeys(configuration.Tags) {
+			list = append(list, cfTypes.Tag{Key: aws.String(k), Value: aws.String(configuration.Tags[k])})
+		}
+		return list, nil
+	}
+	keyValues, err := readKeyValues(data)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read the tags: %w", err)
+	}
+	var list []cfTypes.Tag
+	for _, kv := range keyValues {
+		list = append(list, cfTypes.Tag{Key: aws.String(kv[0]), Value: aws.String(kv[1])})
+	}
+	return list, nil
+}
+
+func firstChar(data []byte) byte {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 {
+		return 0
+	}
+	return trimmed[0]
+}
+
+// readKeyValues reads Key=Value lines, the value can contain = and spaces.
+// Empty lines and lines starting with # are skipped.
+func readKeyValues(data []byte) ([][2]string, error) {
+	var keyValues [][2]string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		kv, ok := splitKeyValue(line)
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected Key=Value, found %q", n, line)
+		}
+		keyValues = append(keyValues, kv)
+	}
+	return keyValues, scanner.Err()
+}
+
+// readKeyValueList reads a JSON list of Key=Value strings, ok is false if
+// data is not a list of strings
+func readKeyValueList(data []byte) (keyValues [][2]string, ok bool, err error) {
+	var items []string
+	if json.Unmarshal(data, &items) != nil {
+		return nil, false, nil
+	}
+	for i, item := range items {
+		kv, valid := splitKeyValue(item)
+		if !valid {
+			return nil, true, fmt.Errorf("item %d: expected Key=Value, found %q", i+1, item)
+		}
+		keyValues = append(keyValues, kv)
+	}
+	return keyValues, true, nil
+}
+
+// splitKeyValue splits Key=Value on the first =, the value can contain =
+func splitKeyValue(s string) ([2]string, bool) {
+	kv := strings.SplitN(s, "=", 2)
+	if len(kv) != 2 || kv[0] == "" {
+		return [2]string{}, false
+	}
+	return [2]string{kv[0], kv[1]}, true
+}
+
+func sortedStringKeys(m map[string]string) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// MergeParameters returns the parameters with the overrides, an override
+// replaces the value of the parameter with the same key
+func MergeParameters(parameters []cfTypes.Parameter, overrides []cfTypes.Parameter) []cfTypes.Parameter {
+	merged := append([]cfTypes.Parameter{}, parameters...)
+	for _, o := range overrides {
+		found := false
+		for i, p := range merged {
+			if aws.ToString(p.ParameterKey) == aws.ToString(o.ParameterKey) {
+				merged[i] = o
+				found = true
+			}
+		}
+		if !found {
+			merged = append(merged, o)
+		}
+	}
+	return merged
+}
+
+// MergeTags returns the tags with the overrides, an override replaces the
+// value of the tag with the same key
+func MergeTags(tags []cfTypes.Tag, overrides []cfTypes.Tag) []cfTypes.Tag {
+	merged := append([]cfTypes.Tag{}, tags...)
+	for _, o := range overrides {
+		found := false
+		for i, t := range merged {
+			if aws.ToString(t.Key) == aws.ToString(o.Key) {
+				merged[i] = o
+				found = true
+			}
+		}
+		if !found {
+			merged = append(merged, o)
+		}
+	}
+	return merged
+}
@@ -0,0 +1,74 @@
+package pkg
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	cfTypes "github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParametersFromFile(t *testing.T) {
+	expected := []cfTypes.Parameter{
+		{ParameterKey: aws.String("Env"), ParameterValue: aws.String("prod")},
+		{ParameterKey: aws.String("Query"), ParameterValue: aws.String("a=b c")},
+	}
+	files := []string{
+		`[{"ParameterKey": "Env", "ParameterValue": "prod"}, {"ParameterKey": "Old", "UsePreviousValue": true}, {"ParameterKey": "Query", "ParameterValue": "a=b c"}]`,
+		`["Env=prod", "Query=a=b c"]`,
+		`{"Parameters": {"Query": "a=b c", "Env": "prod"}, "Tags": {"team": "ops"}}`,
+		"# parameters\nEnv=prod\n\n  Query=a=b c\n",
+	}
+	for _, file := range files {
+		parameters, err := ParametersFromFile([]byte(file))
+		assert.NoError(t, err, file)
+		assert.Exactly(t, expected, parameters, file)
+	}
+
+	_, err := ParametersFromFile([]byte("Env=prod\nSize\n"))
+	assert.EqualError(t, err, "cannot read the parameters: line 2: expected Key=Value, found \"Size\"")
+	_, err = ParametersFromFile([]byte(`[{"ParameterKey": "Env"}]`))
+	assert.EqualError(t, err, "parameter Env: ParameterValue is required")
+	_, err = ParametersFromFile([]byte(`["Env=prod", "Size"]`))
+	assert.EqualError(t, err, "cannot read the parameters: item 2: expected Key=Value, found \"Size\"")
+	_, err = ParametersFromFile([]byte(`[{"ParameterKey": "Env"`))
+	assert.Error(t, err)
+}
+
+func TestTagsFromFile(t *testing.T) {
+	expected := []cfTypes.Tag{
+		{Key: aws.String("cost"), Value: aws.String("1234")},
+		{Key: aws.String("team"), Value: aws.String("ops")},
+	}
+	files := []string{
+		`[{"Key": "cost", "Value": "1234"}, {"Key": "team", "Value": "ops"}]`,
+		`["cost=1234", "team=ops"]`,
+		`{"Parameters": {"Env": "prod"}, "Tags": {"team": "ops", "cost": "1234"}}`,
+		"cost=1234\nteam=ops",
+	}
+	for _, file := range files {
+		tags, err := TagsFromFile([]byte(file))
+		assert.NoError(t, err, file)
+		assert.Exactly(t, expected, tags, file)
+	}
+
+	_, err := TagsFromFile([]byte(`[{"Key": "team"}]`))
+	assert.EqualError(t, err, "tag #1: Key and Value are required")
+}
+
+func TestMergeParameters(t *testing.T) {
+	merged := MergeParameters(
+		[]cfTypes.Parameter{
+			{ParameterKey: aws.String("A"), ParameterValue: aws.String("1")},
+			{ParameterKey: aws.String("B"), ParameterValue: aws.String("1")},
+		},
+		[]cfTypes.Parameter{
+			{ParameterKey: aws.String("B"), ParameterValue: aws.String("2")},
+			{ParameterKey: aws.String("C"), ParameterValue: aws.String("2")},
+		})
+	assert.Exactly(t, []cfTypes.Parameter{
+		{ParameterKey: aws.String("A"), ParameterValue: aws.String("1")},
+		{ParameterKey: aws.String("B"), ParameterValue: aws.String("2")},
+		{ParameterKey: aws.String("C"), ParameterValue: aws.String("2")},
+	}, merged)
+}
@@ -0,0 +1,90 @@
+package pkg
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	cfTypes "github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
+)
+
+// ParameterSource tells where the value of a changeset parameter comes from
+type ParameterSource string
+
+const (
+	// ParameterInherited is the previous value of the stack
+	ParameterInherited ParameterSource = "inherited"
+	// ParameterOverridden is a value given with the changeset
+	ParameterOverridden ParameterSource = "overridden"
+	// ParameterDefaulted is the Default of the template
+	ParameterDefaulted ParameterSource = "defaulted"
+)
+
+// MissingParametersError is the error of the template parameters without a
+// value and without a Default
+type MissingParametersError struct {
+	Keys []string
+}
+
+func (e *MissingParametersError) Error() string {
+	return "missing parameters without a Default: " + strings.Join(e.Keys, ", ")
+}
+
+type ReconciledParameter struct {
+	Key    string
+	Source ParameterSource
+}
+
+// ReconcileParameters returns the parameters of a changeset for the template:
+// the overrides, the previous values of the stack parameters that are still
+// in the template and nothing for the other template parameters, that get
+// their Default. The stack parameters removed from the template are dropped,
+// the overrides that are not in the template are kept to be reported by
+// ValidateParameters. It's an error if a template parameter has no value and
+// no Default. The sources are sorted by key.
+func ReconcileParameters(template Template, stackParameters []cfTypes.Parameter, overrides []cfTypes.Parameter) ([]cfTypes.Parameter, []ReconciledParameter, error) {
+	declarations, _ := template["Parameters"].(map[string]interface{})
+	overridden := map[string]cfTypes.Parameter{}
+	for _, p := range overrides {
+		overridden[aws.ToString(p.ParameterKey)] = p
+	}
+	inStack := map[string]bool{}
+	for _, p := range stackParameters {
+		inStack[aws.ToString(p.ParameterKey)] = true
+	}
+
+	var parameters []cfTypes.Parameter
+	var sources []ReconciledParameter
+	var missing []string
+	for _, key := range sortedKeys(declarations) {
+		declaration, _ := declarations[key].(map[string]interface{})
+		_, hasDefault := declaration["Default"]
+		if p, ok := overridden[key]; ok {
+			parameters = append(parameters, cfTypes.Parameter{
+				ParameterKey:     aws.String(key),
+				ParameterValue:   p.ParameterValue,
+				UsePreviousValue: aws.Bool(false),
+			})
+			sources = append(sources, ReconciledParameter{key, ParameterOverridden})
+		} else if inStack[key] {
+			parameters = append(parameters, cfTypes.Parameter{
+				ParameterKey:     aws.String(key),
+				UsePreviousValue: aws.Bool(true),
+			})
+			sources = append(sources, ReconciledParameter{key, ParameterInherited})
+		} else if hasDefault {
+			sources = append(sources, ReconciledParameter{key, ParameterDefaulted})
+		} else {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, nil, &MissingParametersError{Keys: missing}
+	}
+
+	for _, p := range overrides {
+		if _, ok := declarations[aws.ToString(p.ParameterKey)]; !ok {
+			parameters = append(parameters, p)
+		}
+	}
+	return parameters, sources, nil
+}
@@ -0,0 +1,39 @@
+package pkg
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	cfTypes "github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReconcileParameters(t *testing.T) {
+	template, err := ParseTemplate([]byte(`
+Parameters:
+  Env: {Type: String}
+  Size: {Type: Number}
+  Added: {Type: String, Default: x}
+Resources: {}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stackParameters := parameterList("Env", "prod", "Size", "1", "Removed", "y")
+
+	parameters, sources, err := ReconcileParameters(template, stackParameters, parameterList("Size", "2", "Typo", "z"))
+	assert.NoError(t, err)
+	assert.Exactly(t, []cfTypes.Parameter{
+		{ParameterKey: aws.String("Env"), UsePreviousValue: aws.Bool(true)},
+		{ParameterKey: aws.String("Size"), ParameterValue: aws.String("2"), UsePreviousValue: aws.Bool(false)},
+		{ParameterKey: aws.String("Typo"), ParameterValue: aws.String("z")},
+	}, parameters)
+	assert.Equal(t, []ReconciledParameter{
+		{"Added", ParameterDefaulted},
+		{"Env", ParameterInherited},
+		{"Size", ParameterOverridden},
+	}, sources)
+
+	_, _, err = ReconcileParameters(template, nil, parameterList("Size", "2"))
+	assert.EqualError(t, err, "missing parameters without a Default: Env")
+}
@@ -0,0 +1,152 @@
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	cfTypes "github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
+)
+
+// ValidateParameters checks the parameter values against the Parameters
+// section of the template: the keys must be declared and the values must
+// respect the Type, AllowedValues, AllowedPattern, MinLength, MaxLength,
+// MinValue and MaxValue of the declaration. The parameters that use the
+// previous value are not checked. The error lists all the violations, with
+// the ConstraintDescription of the parameter.
+func ValidateParameters(template Template, parameters []cfTypes.Parameter) error {
+	declarations, _ := template["Parameters"].(map[string]interface{})
+	var violations []string
+	for _, p := range parameters {
+		if p.ParameterKey == nil || aws.ToBool(p.UsePreviousValue) {
+			continue
+		}
+		key := *p.ParameterKey
+		declaration, ok := declarations[key].(map[string]interface{})
+		if !ok {
+			violations = append(violations, fmt.Sprintf("%s: not a parameter of the template", key))
+			continue
+		}
+		v := parameterValidator{declaration: declaration, noEcho: declaration["NoEcho"] == "true"}
+		if violation := v.validate(aws.ToString(p.ParameterValue)); violation != "" {
+			if description, ok := declaration["ConstraintDescription"].(string); ok && description != "" {
+				violation += " (" + description + ")"
+			}
+			violations = append(violations, key+": "+violation)
+		}
+	}
+	if len(violations) == 0 {
+		return nil
+	}
+	sort.Strings(violations)
+	return errors.New("invalid parameters:\n  " + strings.Join(violations, "\n  "))
+}
+
+// parameterValidator checks the values of a parameter declaration, the
+// values of NoEcho parameters are masked in the violations
+type parameterValidator struct {
+	declaration map[string]interface{}
+	noEcho      bool
+}
+
+func (v parameterValidator) quote(value string) string {
+	if v.noEcho {
+		return strconv.Quote(NoEchoMask)
+	}
+	return strconv.Quote(value)
+}
+
+// validate returns the first violation of the declaration
+func (v parameterValidator) validate(value string) string {
+	parameterType, _ := v.declaration["Type"].(string)
+	switch {
+	case strings.HasPrefix(parameterType, "AWS::SSM::Parameter::"):
+		// the value is the name of an SSM parameter
+		return ""
+	case parameterType == "Number":
+		return v.validateNumber(value)
+	case parameterType == "List<Number>":
+		for _, item := range strings.Split(value, ",") {
+			if violation := v.validateNumber(strings.TrimSpace(item)); violation != "" {
+				return violation
+			}
+		}
+		return ""
+	case parameterType == "CommaDelimitedList" || strings.HasPrefix(parameterType, "List<"):
+		for _, item := range strings.Split(value, ",") {
+			if violation := v.validateAllowed(strings.TrimSpace(item)); violation != "" {
+				return violation
+			}
+		}
+		return ""
+	}
+	if violation := v.validateAllowed(value); violation != "" {
+		return violation
+	}
+	if min, ok := intAttribute(v.declaration, "MinLength"); ok && len(value) < min {
+		return fmt.Sprintf("value %s is shorter than the MinLength %d", v.quote(value), min)
+	}
+	if max, ok := intAttribute(v.declaration, "MaxLength"); ok && len(value) > max {
+		return fmt.Sprintf("value %s is longer than the MaxLength %d", v.quote(value), max)
+	}
+	return ""
+}
+
+func (v parameterValidator) validateNumber(value string) string {
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return fmt.Sprintf("value %s is not a Number", v.quote(value))
+	}
+	if violation := v.validateAllowed(value); violation != "" {
+		return violation
+	}
+	if min, ok := floatAttribute(v.declaration, "MinValue"); ok && n < min {
+		return fmt.Sprintf("value %s is less than the MinValue %s", v.quote(value), v.declaration["MinValue"])
+	}
+	if max, ok := floatAttribute(v.declaration, "MaxValue"); ok && n > max {
+		return fmt.Sprintf("value %s is greater than the MaxValue %s", v.quote(value), v.declaration["MaxValue"])
+	}
+	return ""
+}
+
+// validateAllowed checks the AllowedValues and the AllowedPattern, a pattern
+// that is not a valid Go regular expression is not checked
+func (v parameterValidator) validateAllowed(value string) string {
+	if allowedValues, ok := v.declaration["AllowedValues"].([]interface{}); ok {
+		allowed := false
+		var values []string
+		for _, allowedValue := range allowedValues {
+			s, _ := allowedValue.(string)
+			values = append(values, s)
+			if s == value {
+				allowed = true
+			}
+		}
+		if !allowed {
+			return fmt.Sprintf("value %s is not one of the AllowedValues %s", v.quote(value), strings.Join(values, ", "))
+		}
+	}
+	if pattern, ok := v.declaration["AllowedPattern"].(string); ok {
+		re, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err == nil && !re.MatchString(value) {
+			return fmt.Sprintf("value %s does not match the AllowedPattern %s", v.quote(value), pattern)
+		}
+	}
+	return ""
+}
+
+func intAttribute(declaration map[string]interface{}, name string) (int, bool) {
+	s, _ := declaration[name].(string)
+	n, err := strconv.Atoi(s)
+	return n, err == nil
+}
+
+func floatAttribute(declaration map[string]interface{}, name string) (float64, bool) {
+	s, _ := declaration[name].(string)
+	n, err := strconv.ParseFloat(s, 64)
+	return n, err == nil
+}
@@ -0,0 +1,83 @@
+package pkg
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	cfTypes "github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
+	"github.com/stretchr/testify/assert"
+)
+
+const validationTemplate = `
+Parameters:
+  Env:
+    Type: String
+    AllowedValues: [dev, prod]
+  Name:
+    Type: String
+    AllowedPattern: '[a-z][a-z0-9-]*'
+    MinLength: 3
+    MaxLength: 8
+    ConstraintDescription: lowercase letters, digits and dashes
+  Size:
+    Type: Number
+    MinValue: 1
+    MaxValue: 10
+  Ports:
+    Type: List<Number>
+  Zones:
+    Type: CommaDelimitedList
+    AllowedValues: [a, b, c]
+  Password:
+    Type: String
+    NoEcho: true
+    MinLength: 8
+  Ami:
+    Type: AWS::SSM::Parameter::Value<AWS::EC2::Image::Id>
+    AllowedPattern: 'ami-.*'
+Resources: {}
+`
+
+func parameterList(keyValues ...string) []cfTypes.Parameter {
+	var list []cfTypes.Parameter
+	for i := 0; i+1 < len(keyValues); i += 2 {
+		list = append(list, cfTypes.Parameter{ParameterKey: aws.String(keyValues[i]), ParameterValue: aws.String(keyValues[i+1])})
+	}
+	return list
+}
+
+func TestValidateParameters(t *testing.T) {
+	template, err := ParseTemplate([]byte(validationTemplate))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	valid := parameterList("Env", "prod", "Name", "my-app", "Size", "10", "Ports", "80, 443", "Zones", "a,c", "Password", "12345678", "Ami", "/ami/latest")
+	valid = append(valid, cfTypes.Parameter{ParameterKey: aws.String("Removed"), UsePreviousValue: aws.Bool(true)})
+	assert.NoError(t, ValidateParameters(template, valid))
+
+	tests := []struct {
+		parameters []cfTypes.Parameter
+		violation  string
+	}{
+		{parameterList("Env", "staging"), `Env: value "staging" is not one of the AllowedValues dev, prod`},
+		{parameterList("Name", "My-app"), `Name: value "My-app" does not match the AllowedPattern [a-z][a-z0-9-]* (lowercase letters, digits and dashes)`},
+		{parameterList("Name", "ab"), `Name: value "ab" is shorter than the MinLength 3 (lowercase letters, digits and dashes)`},
+		{parameterList("Name", "abcdefghi"), `Name: value "abcdefghi" is longer than the MaxLength 8 (lowercase letters, digits and dashes)`},
+		{parameterList("Size", "big"), `Size: value "big" is not a Number`},
+		{parameterList("Size", "0"), `Size: value "0" is less than the MinValue 1`},
+		{parameterList("Size", "11"), `Size: value "11" is greater than the MaxValue 10`},
+		{parameterList("Ports", "80,http"), `Ports: value "http" is not a Number`},
+		{parameterList("Zones", "a,d"), `Zones: value "d" is not one of the AllowedValues a, b, c`},
+		{parameterList("Password", "secret"), `Password: value "****" is shorter than the MinLength 8`},
+		{parameterList("Typo", "x"), `Typo: not a parameter of the template`},
+	}
+	for _, test := range tests {
+		assert.EqualError(t, ValidateParameters(template, test.parameters), "invalid parameters:\n  "+test.violation)
+	}
+
+	assert.EqualError(t, ValidateParameters(template, parameterList("Size", "0", "Env", "x")),
+		"invalid parameters:\n"+
+			"  Env: value \"x\" is not one of the AllowedValues dev, prod\n"+
+			"  Size: value \"0\" is less than the MinValue 1")
+}
@@ -0,0 +1,48 @@
+package pkg
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+type S3API interface {
+	PutObject(ctx context.Context, params *s3.PutObjectInput) (*s3.PutObjectOutput, error)
+	GetObject(ctx context.Context, params *s3.GetObjectInput) (*s3.GetObjectOutput, error)
+	DeleteObject(ctx context.Context, params *s3.DeleteObjectInput) (*s3.DeleteObjectOutput, error)
+}
+type S3Client struct {
+	*s3.Client
+	Region string
+}
+
+func (client S3Client) PutObject(ctx context.Context, params *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+	return client.Client.PutObject(ctx, params)
+}
+func (client S3Client) GetObject(ctx context.Context, params *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	return client.Client.GetObject(ctx, params)
+}
+func (client S3Client) DeleteObject(ctx context.Context, params *s3.DeleteObjectInput) (*s3.DeleteObjectOutput, error) {
+	return client.Client.DeleteObject(ctx, params)
+}
+
+// NewS3Client creates an S3 client, if endpoint is not empty all the requests
+// are sent to it using path style URLs (useful with S3 compatible services)
+func NewS3Client(endpoint string) (*S3Client, error) {
+	awsCfg, err := config.LoadDefaultConfig(context.TODO())
+	if err != nil {
+		return nil, err
+	}
+	s3Client := s3.NewFromConfig(awsCfg, func(o *s3.Options) {
+		if endpoint != "" {
+			o.EndpointResolver = s3.EndpointResolverFromURL(endpoint)
+			o.UsePathStyle = true
+		}
+	})
+	return &S3Client{
+		Client: s3Client,
+		Region: awsCfg.Region,
+	}, nil
+}
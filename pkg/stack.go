@@ -0,0 +1,175 @@
+package pkg
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	cfTypes "github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
+)
+
+const StackRefPrefix = "stack:"
+
+// NoEchoMask replaces the values of the NoEcho parameters, like in the
+// DescribeStacks output
+const NoEchoMask = "****"
+
+// StackRef identifies a deployed stack, optionally in another region or
+// with another profile of the shared configuration:
+// stack:my-stack,region=eu-west-1,profile=prod
+type StackRef struct {
+	Name    string
+	Region  string
+	Profile string
+}
+
+// IsStackRef tells if s is a stack reference instead of a template location
+func IsStackRef(s string) bool {
+	return strings.HasPrefix(s, StackRefPrefix)
+}
+
+// ParseStackRef parses a stack reference, the stack: prefix is optional
+func ParseStackRef(s string) (StackRef, error) {
+	parts := strings.Split(strings.TrimPrefix(s, StackRefPrefix), ",")
+	ref := StackRef{Name: parts[0]}
+	if ref.Name == "" {
+		return ref, fmt.Errorf("invalid stack %q: missing stack name", s)
+	}
+	for _, option := range parts[1:] {
+		kv := strings.SplitN(option, "=", 2)
+		if len(kv) != 2 || kv[1] == "" {
+			return ref, fmt.Errorf("invalid stack %q: expected region=... or profile=..., found %q", s, option)
+		}
+		switch kv[0] {
+		case "region":
+			ref.Region = kv[1]
+		case "profile":
+			ref.Profile = kv[1]
+		default:
+			return ref, fmt.Errorf("invalid stack %q: unknown option %q", s, kv[0])
+		}
+	}
+	return ref, nil
+}
+
+// StackSettings are the values of a stack that are not in its template.
+// Outputs are interface{} because the value of a new output is known only
+// after the deploy, until then it's the template value, like {"Ref": "X"}.
+type StackSettings struct {
+	Parameters map[string]string
+	Tags       map[string]string
+	Outputs    map[string]interface{}
+}
+
+func NewStackSettings(stack *cfTypes.Stack) StackSettings {
+	settings := StackSettings{
+		Parameters: map[string]string{},
+		Tags:       map[string]string{},
+		Outputs:    map[string]interface{}{},
+	}
+	for _, p := range stack.Parameters {
+		if p.ParameterKey != nil {
+			settings.Parameters[*p.ParameterKey] = aws.ToString(p.ParameterValue)
+		}
+	}
+	for _, t := range stack.Tags {
+		if t.Key != nil {
+			settings.Tags[*t.Key] = aws.ToString(t.Value)
+		}
+	}
+	for _, o := range stack.Outputs {
+		if o.OutputKey != nil {
+			settings.Outputs[*o.OutputKey] = aws.ToString(o.OutputValue)
+		}
+	}
+	return settings
+}
+
+// ExpectedStackSettings returns the settings of the stack after deploying
+// the template with the parameters and the tags of a changeset. The
+// parameters with UsePreviousValue keep the stack value and the missing ones
+// get the template default, the values of the NoEcho parameters are masked.
+// Nil tags keep the stack tags. The outputs with an intrinsic function value
+// keep the stack value if they exist.
+func ExpectedStackSettings(stack *cfTypes.Stack, template Template, parameters []cfTypes.Parameter, tags []cfTypes.Tag) StackSettings {
+	current := NewStackSettings(stack)
+	settings := StackSettings{
+		Parameters: map[string]string{},
+		Tags:       current.Tags,
+		Outputs:    map[string]interface{}{},
+	}
+
+	values := map[string]string{}
+	for _, p := range parameters {
+		if p.ParameterKey == nil {
+			continue
+		}
+		if aws.ToBool(p.UsePreviousValue) {
+			if value, ok := current.Parameters[*p.ParameterKey]; ok {
+				values[*p.ParameterKey] = value
+			}
+			continue
+		}
+		values[*p.ParameterKey] = aws.ToString(p.ParameterValue)
+	}
+	templateParameters, _ := template["Parameters"].(map[string]interface{})
+	for name, definition := range templateParameters {
+		d, _ := definition.(map[string]interface{})
+		value, ok := values[name]
+		if !ok {
+			value, ok = d["Default"].(string)
+		}
+		if !ok {
+			continue
+		}
+		if d["NoEcho"] == "true" {
+			value = NoEchoMask
+		}
+		settings.Parameters[name] = value
+	}
+
+	if tags != nil {
+		settings.Tags = map[string]string{}
+		for _, t := range tags {
+			if t.Key != nil {
+				settings.Tags[*t.Key] = aws.ToString(t.Value)
+			}
+		}
+	}
+
+	templateOutputs, _ := template["Outputs"].(map[string]interface{})
+	for name, definition := range templateOutputs {
+		d, _ := definition.(map[string]interface{})
+		value := d["Value"]
+		if _, isString := value.(string); !isString {
+			if deployed, ok := current.Outputs[name]; ok {
+				value = deployed
+			}
+		}
+		settings.Outputs[name] = value
+	}
+	return settings
+}
+
+// CompareStackSettings returns the differences of the parameters, tags and
+// outputs of two stacks, in the StackParameters, StackTags and StackOutputs
+// sections
+func CompareStackSettings(old StackSettings, new StackSettings) []TemplateChange {
+	var changes []TemplateChange
+	changes = append(changes, compareSettings("StackParameters", old.Parameters, new.Parameters)...)
+	changes = append(changes, compareSettings("StackTags", old.Tags, new.Tags)...)
+	changes = append(changes, compareValues("StackOutputs", "StackOutputs", old.Outputs, true, new.Outputs, true)...)
+	return changes
+}
+
+func compareSettings(section string, old map[string]string, new map[string]string) []TemplateChange {
+	oldValues := map[string]interface{}{}
+	for k, v := range old {
+		oldValues[k] = v
+	}
+	newValues := map[string]interface{}{}
+	for k, v := range new {
+		newValues[k] = v
+	}
+	return compareValues(section, section, oldValues, true, newValues, true)
+}
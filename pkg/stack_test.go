@@ -0,0 +1,110 @@
+package pkg
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	cfTypes "github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseStackRef(t *testing.T) {
+	tests := []struct {
+		s   string
+		ref StackRef
+		ok  bool
+	}{
+		{"my-stack", StackRef{Name: "my-stack"}, true},
+		{"stack:my-stack", StackRef{Name: "my-stack"}, true},
+		{"stack:my-stack,region=eu-west-1", StackRef{Name: "my-stack", Region: "eu-west-1"}, true},
+		{"stack:my-stack,profile=prod,region=us-east-1", StackRef{Name: "my-stack", Region: "us-east-1", Profile: "prod"}, true},
+		{"stack:", StackRef{}, false},
+		{"stack:my-stack,region", StackRef{}, false},
+		{"stack:my-stack,role=x", StackRef{}, false},
+	}
+	for _, test := range tests {
+		ref, err := ParseStackRef(test.s)
+		if !test.ok {
+			assert.Error(t, err, test.s)
+			continue
+		}
+		assert.NoError(t, err, test.s)
+		assert.Equal(t, test.ref, ref, test.s)
+	}
+}
+
+func TestCompareStackSettings(t *testing.T) {
+	old := NewStackSettings(&cfTypes.Stack{
+		Parameters: []cfTypes.Parameter{
+			{ParameterKey: aws.String("Env"), ParameterValue: aws.String("staging")},
+			{ParameterKey: aws.String("Size"), ParameterValue: aws.String("1")},
+		},
+		Tags:    []cfTypes.Tag{{Key: aws.String("team"), Value: aws.String("a")}},
+		Outputs: []cfTypes.Output{{OutputKey: aws.String("Url"), OutputValue: aws.String("https://staging")}},
+	})
+	new := NewStackSettings(&cfTypes.Stack{
+		Parameters: []cfTypes.Parameter{
+			{ParameterKey: aws.String("Env"), ParameterValue: aws.String("prod")},
+		},
+		Tags:    []cfTypes.Tag{{Key: aws.String("team"), Value: aws.String("a")}, {Key: aws.String("cost"), Value: aws.String("x")}},
+		Outputs: []cfTypes.Output{{OutputKey: aws.String("Url"), OutputValue: aws.String("https://prod")}},
+	})
+	assert.Equal(t, []TemplateChange{
+		{Kind: TemplateChangeModify, Section: "StackParameters", Path: "StackParameters.Env", OldValue: "staging", NewValue: "prod"},
+		{Kind: TemplateChangeRemove, Section: "StackParameters", Path: "StackParameters.Size", OldValue: "1"},
+		{Kind: TemplateChangeAdd, Section: "StackTags", Path: "StackTags.cost", NewValue: "x"},
+		{Kind: TemplateChangeModify, Section: "StackOutputs", Path: "StackOutputs.Url", OldValue: "https://staging", NewValue: "https://prod"},
+	}, CompareStackSettings(old, new))
+}
+
+func TestExpectedStackSettings(t *testing.T) {
+	stack := &cfTypes.Stack{
+		Parameters: []cfTypes.Parameter{
+			{ParameterKey: aws.String("Env"), ParameterValue: aws.String("staging")},
+			{ParameterKey: aws.String("Size"), ParameterValue: aws.String("1")},
+			{ParameterKey: aws.String("Password"), ParameterValue: aws.String(NoEchoMask)},
+			{ParameterKey: aws.String("Removed"), ParameterValue: aws.String("x")},
+		},
+		Tags: []cfTypes.Tag{{Key: aws.String("team"), Value: aws.String("a")}},
+		Outputs: []cfTypes.Output{
+			{OutputKey: aws.String("Arn"), OutputValue: aws.String("arn:role")},
+			{OutputKey: aws.String("Version"), OutputValue: aws.String("1")},
+		},
+	}
+	template, err := ParseTemplate([]byte(`
+Parameters:
+  Env: {Type: String}
+  Size: {Type: Number}
+  Password: {Type: String, NoEcho: true}
+  Added: {Type: String, Default: new}
+Resources:
+  Role: {Type: AWS::IAM::Role}
+Outputs:
+  Arn: {Value: !GetAtt Role.Arn}
+  Version: {Value: 2}
+  Name: {Value: !Ref Role}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parameters := []cfTypes.Parameter{
+		{ParameterKey: aws.String("Env"), UsePreviousValue: aws.Bool(true)},
+		{ParameterKey: aws.String("Size"), ParameterValue: aws.String("2"), UsePreviousValue: aws.Bool(false)},
+		{ParameterKey: aws.String("Password"), ParameterValue: aws.String("secret"), UsePreviousValue: aws.Bool(false)},
+		{ParameterKey: aws.String("Removed"), UsePreviousValue: aws.Bool(true)},
+	}
+
+	expected := ExpectedStackSettings(stack, template, parameters, nil)
+	assert.Equal(t, StackSettings{
+		Parameters: map[string]string{"Env": "staging", "Size": "2", "Password": NoEchoMask, "Added": "new"},
+		Tags:       map[string]string{"team": "a"},
+		Outputs: map[string]interface{}{
+			"Arn":     "arn:role",
+			"Version": "2",
+			"Name":    map[string]interface{}{"Ref": "Role"},
+		},
+	}, expected)
+
+	expected = ExpectedStackSettings(stack, template, parameters, []cfTypes.Tag{{Key: aws.String("team"), Value: aws.String("b")}})
+	assert.Equal(t, map[string]string{"team": "b"}, expected.Tags)
+}
@@ -0,0 +1,207 @@
+package pkg
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Template is a parsed CloudFormation template. Mappings are
+// map[string]interface{}, sequences []interface{} and all the scalars but
+// null are strings, so that 80 and "80" are the same value. The YAML short
+// form intrinsic functions are converted to the long form: !Ref X becomes
+// {"Ref": "X"} and !GetAtt A.B becomes {"Fn::GetAtt": ["A", "B"]}.
+type Template map[string]interface{}
+
+// The sections of a template, in the order they are usually written
+var TemplateSections = []string{
+	"AWSTemplateFormatVersion",
+	"Description",
+	"Metadata",
+	"Transform",
+	"Parameters",
+	"Rules",
+	"Mappings",
+	"Conditions",
+	"Resources",
+	"Outputs",
+}
+
+// ParseTemplate parses a YAML or JSON template
+func ParseTemplate(body []byte) (Template, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(body, &document); err != nil {
+		return nil, fmt.Errorf("cannot parse the template: %w", err)
+	}
+	if len(document.Content) == 0 {
+		return nil, errors.New("cannot parse the template: empty template")
+	}
+	value, err := templateValue(document.Content[0])
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse the template: %w", err)
+	}
+	template, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("cannot parse the template: not a mapping")
+	}
+	return template, nil
+}
+
+func templateValue(node *yaml.Node) (interface{}, error) {
+	if node.Kind == yaml.AliasNode {
+		return templateValue(node.Alias)
+	}
+	value, err := untaggedValue(node)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(node.Tag, "!") || strings.HasPrefix(node.Tag, "!!") {
+		return value, nil
+	}
+	name := strings.TrimPrefix(node.Tag, "!")
+	switch name {
+	case "Ref", "Condition":
+		return map[string]interface{}{name: value}, nil
+	case "GetAtt":
+		if s, ok := value.(string); ok {
+			parts := strings.SplitN(s, ".", 2)
+			if len(parts) != 2 {
+				return nil, fmt.Errorf("line %d: invalid !GetAtt %q", node.Line, s)
+			}
+			value = []interface{}{parts[0], parts[1]}
+		}
+	}
+	return map[string]interface{}{"Fn::" + name: value}, nil
+}
+
+func untaggedValue(node *yaml.Node) (interface{}, error) {
+	switch node.Kind {
+	case yaml.MappingNode:
+		m := make(map[string]interface{}, len(node.Content)/2)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			v, err := templateValue(value)
+			if err != nil {
+				return nil, err
+			}
+			m[key.Value] = v
+		}
+		return m, nil
+	case yaml.SequenceNode:
+		s := make([]interface{}, 0, len(node.Content))
+		for _, item := range node.Content {
+			v, err := templateValue(item)
+			if err != nil {
+				return nil, err
+			}
+			s = append(s, v)
+		}
+		return s, nil
+	case yaml.ScalarNode:
+		switch node.ShortTag() {
+		case "!!null":
+			return nil, nil
+		case "!!bool":
+			var b bool
+			if err := node.Decode(&b); err != nil {
+				return nil, err
+			}
+			return strconv.FormatBool(b), nil
+		}
+		return node.Value, nil
+	}
+	return nil, fmt.Errorf("line %d: unexpected YAML node", node.Line)
+}
+
+// IsJsonTemplate tells if the template body is JSON instead of YAML
+func IsJsonTemplate(body []byte) bool {
+	trimmed := bytes.TrimSpace(body)
+	return len(trimmed) > 0 && trimmed[0] == '{'
+}
+
+// NormalizeTemplate rewrites a YAML or JSON template in a canonical YAML
+// form, so that two equivalent templates have the same text: the sections
+// are in the TemplateSections order, all the other keys are sorted, the
+// intrinsic functions use the short form and the comments are removed.
+func NormalizeTemplate(body []byte) ([]byte, error) {
+	template, err := ParseTemplate(body)
+	if err != nil {
+		return nil, err
+	}
+	return MarshalTemplate(template)
+}
+
+// MarshalTemplate writes a template in the canonical YAML form of
+// NormalizeTemplate
+func MarshalTemplate(template Template) ([]byte, error) {
+	root := &yaml.Node{Kind: yaml.MappingNode}
+	for _, section := range sortedSections(template, nil) {
+		root.Content = append(root.Content, stringNode(section), templateNode(template[section]))
+	}
+	var out bytes.Buffer
+	encoder := yaml.NewEncoder(&out)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(root); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+func stringNode(s string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: s}
+}
+
+func templateNode(value interface{}) *yaml.Node {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if node := shortFormNode(v); node != nil {
+			return node
+		}
+		node := &yaml.Node{Kind: yaml.MappingNode}
+		for _, k := range sortedKeys(v) {
+			node.Content = append(node.Content, stringNode(k), templateNode(v[k]))
+		}
+		return node
+	case []interface{}:
+		node := &yaml.Node{Kind: yaml.SequenceNode}
+		for _, item := range v {
+			node.Content = append(node.Content, templateNode(item))
+		}
+		return node
+	case string:
+		return stringNode(v)
+	}
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}
+}
+
+// shortFormNode returns the short form of an intrinsic function, or nil if
+// the function must be written in the long form because its argument is an
+// intrinsic function too (a YAML node can't have two tags)
+func shortFormNode(m map[string]interface{}) *yaml.Node {
+	if !isIntrinsicFunction(m) {
+		return nil
+	}
+	for name, arg := range m {
+		if args, ok := arg.([]interface{}); ok && name == "Fn::GetAtt" && len(args) == 2 {
+			resource, isString := args[0].(string)
+			attribute, isAttributeString := args[1].(string)
+			if isString && isAttributeString {
+				arg = resource + "." + attribute
+			}
+		}
+		node := templateNode(arg)
+		if !strings.HasPrefix(node.Tag, "!!") && node.Tag != "" {
+			return nil
+		}
+		node.Tag = "!" + strings.TrimPrefix(name, "Fn::")
+		return node
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package pkg
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+type TemplateChangeKind string
+
+const (
+	TemplateChangeAdd    TemplateChangeKind = "Add"
+	TemplateChangeRemove TemplateChangeKind = "Remove"
+	TemplateChangeModify TemplateChangeKind = "Modify"
+)
+
+// TemplateChange is a difference between two templates. Path is the
+// location of the changed value, like
+// Resources.SampleRole.Properties.ManagedPolicyArns[1]
+type TemplateChange struct {
+	Kind     TemplateChangeKind
+	Section  string
+	Path     string
+	OldValue interface{}
+	NewValue interface{}
+}
+
+// CompareTemplates returns the differences between two parsed templates,
+// sorted by section (in the TemplateSections order) and path
+func CompareTemplates(old Template, new Template) []TemplateChange {
+	var changes []TemplateChange
+	for _, section := range sortedSections(old, new) {
+		oldValue, inOld := old[section]
+		newValue, inNew := new[section]
+		changes = append(changes, compareValues(section, section, oldValue, inOld, newValue, inNew)...)
+	}
+	return changes
+}
+
+// sortedSections returns the sections of both the templates, the known
+// sections first
+func sortedSections(old Template, new Template) []string {
+	var sections []string
+	known := map[string]bool{}
+	for _, s := range TemplateSections {
+		known[s] = true
+		if _, ok := old[s]; ok {
+			sections = append(sections, s)
+		} else if _, ok := new[s]; ok {
+			sections = append(sections, s)
+		}
+	}
+	var others []string
+	for _, s := range sortedKeys(old, new) {
+		if !known[s] {
+			others = append(others, s)
+		}
+	}
+	return append(sections, others...)
+}
+
+func compareValues(section string, path string, oldValue interface{}, inOld bool, newValue interface{}, inNew bool) []TemplateChange {
+	switch {
+	case !inOld:
+		return []TemplateChange{{Kind: TemplateChangeAdd, Section: section, Path: path, NewValue: newValue}}
+	case !inNew:
+		return []TemplateChange{{Kind: TemplateChangeRemove, Section: section, Path: path, OldValue: oldValue}}
+	}
+
+	oldMap, oldIsMap := oldValue.(map[string]interface{})
+	newMap, newIsMap := newValue.(map[string]interface{})
+	if oldIsMap && newIsMap && !isIntrinsicFunction(oldMap) && !isIntrinsicFunction(newMap) {
+		var changes []TemplateChange
+		for _, k := range sortedKeys(oldMap, newMap) {
+			o, inO := oldMap[k]
+			n, inN := newMap[k]
+			changes = append(changes, compareValues(section, path+"."+k, o, inO, n, inN)...)
+		}
+		return changes
+	}
+
+	oldList, oldIsList := oldValue.([]interface{})
+	newList, newIsList := newValue.([]interface{})
+	if oldIsList && newIsList {
+		var changes []TemplateChange
+		for i := 0; i < len(oldList) || i < len(newList); i++ {
+			var o, n interface{}
+			if i < len(oldList) {
+				o = oldList[i]
+			}
+			if i < len(newList) {
+				n = newList[i]
+			}
+			changes = append(changes, compareValues(section, fmt.Sprintf("%s[%d]", path, i), o, i < len(oldList), n, i < len(newList))...)
+		}
+		return changes
+	}
+
+	if reflect.DeepEqual(oldValue, newValue) {
+		return nil
+	}
+	return []TemplateChange{{Kind: TemplateChangeModify, Section: section, Path: path, OldValue: oldValue, NewValue: newValue}}
+}
+
+// isIntrinsicFunction tells if m is an intrinsic function like {"Ref": "X"},
+// functions are compared as a whole
+func isIntrinsicFunction(m map[string]interface{}) bool {
+	if len(m) != 1 {
+		return false
+	}
+	for k := range m {
+		return k == "Ref" || k == "Condition" || strings.HasPrefix(k, "Fn::")
+	}
+	return false
+}
+
+func sortedKeys(maps ...map[string]interface{}) []string {
+	seen := map[string]bool{}
+	var keys []string
+	for _, m := range maps {
+		for k := range m {
+			if !seen[k] {
+				seen[k] = true
+				keys = append(keys, k)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,75 @@
+package pkg
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func readTestTemplate(t *testing.T, fileName string) Template {
+	body, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template, err := ParseTemplate(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return template
+}
+
+func TestCompareTemplates(t *testing.T) {
+	changes := CompareTemplates(
+		readTestTemplate(t, "../testdata/sample-1.yaml"),
+		readTestTemplate(t, "../testdata/sample-3.yaml"),
+	)
+	assert.Equal(t,
+		[]TemplateChange{
+			{
+				Kind:    TemplateChangeAdd,
+				Section: "Parameters",
+				Path:    "Parameters.MyTag",
+				NewValue: map[string]interface{}{
+					"Type": "String",
+				},
+			},
+			{
+				Kind:     TemplateChangeRemove,
+				Section:  "Resources",
+				Path:     "Resources.SampleRole",
+				OldValue: readTestTemplate(t, "../testdata/sample-1.yaml")["Resources"].(map[string]interface{})["SampleRole"],
+			},
+			{
+				Kind:     TemplateChangeAdd,
+				Section:  "Resources",
+				Path:     "Resources.SampleRole2",
+				NewValue: readTestTemplate(t, "../testdata/sample-3.yaml")["Resources"].(map[string]interface{})["SampleRole2"],
+			},
+			{
+				Kind:     TemplateChangeModify,
+				Section:  "Outputs",
+				Path:     "Outputs.SampleRole.Value",
+				OldValue: map[string]interface{}{"Ref": "SampleRole"},
+				NewValue: map[string]interface{}{"Ref": "SampleRole2"},
+			},
+		},
+		changes)
+}
+
+func TestCompareTemplates_lists(t *testing.T) {
+	old, _ := ParseTemplate([]byte("Resources:\n  R:\n    Properties:\n      L: [a, b, c]\n"))
+	new, _ := ParseTemplate([]byte("Resources:\n  R:\n    Properties:\n      L: [a, x]\n"))
+	assert.Equal(t,
+		[]TemplateChange{
+			{Kind: TemplateChangeModify, Section: "Resources", Path: "Resources.R.Properties.L[1]", OldValue: "b", NewValue: "x"},
+			{Kind: TemplateChangeRemove, Section: "Resources", Path: "Resources.R.Properties.L[2]", OldValue: "c"},
+		},
+		CompareTemplates(old, new))
+}
+
+func TestCompareTemplates_equal(t *testing.T) {
+	old, _ := ParseTemplate([]byte("Resources:\n  R:\n    Type: 'T'\n    Properties: {Port: 80}\n"))
+	new, _ := ParseTemplate([]byte(`{"Resources": {"R": {"Properties": {"Port": "80"}, "Type": "T"}}}`))
+	assert.Empty(t, CompareTemplates(old, new))
+}
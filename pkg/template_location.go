@@ -0,0 +1,95 @@
+package pkg
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/dchest/uniuri"
+)
+
+// MaxTemplateBodySize is the maximum size of a template passed inline to
+// CloudFormation, bigger templates must be uploaded to S3
+const MaxTemplateBodySize = 51200
+
+// IsTemplateUrl tells if the template location is an s3:// or http(s):// URL
+// instead of a local file
+func IsTemplateUrl(location string) bool {
+	return strings.HasPrefix(location, "s3://") ||
+		strings.HasPrefix(location, "https://") ||
+		strings.HasPrefix(location, "http://")
+}
+
+// ParseS3Url returns the bucket and the key of an s3://bucket/key URL or of
+// an https URL of an S3 object, both virtual hosted and path style. The path
+// style URLs of a custom endpoint are recognized too.
+func ParseS3Url(location string, endpoint string) (bucket string, key string, ok bool) {
+	if strings.HasPrefix(location, "s3://") {
+		bucket, key = splitBucketKey(strings.TrimPrefix(location, "s3://"))
+		return bucket, key, bucket != "" && key != ""
+	}
+	if endpoint != "" && strings.HasPrefix(location, strings.TrimSuffix(endpoint, "/")+"/") {
+		bucket, key = splitBucketKey(strings.TrimPrefix(location, strings.TrimSuffix(endpoint, "/")+"/"))
+		return bucket, key, bucket != "" && key != ""
+	}
+	u, err := url.Parse(location)
+	if err != nil || u.Scheme != "https" || !strings.HasSuffix(u.Host, ".amazonaws.com") {
+		return "", "", false
+	}
+	path := strings.TrimPrefix(u.Path, "/")
+	if strings.HasPrefix(u.Host, "s3.") || strings.HasPrefix(u.Host, "s3-") {
+		// path style: https://s3.region.amazonaws.com/bucket/key
+		bucket, key = splitBucketKey(path)
+	} else if i := strings.Index(u.Host, ".s3."); i > 0 {
+		// virtual hosted: https://bucket.s3.region.amazonaws.com/key
+		bucket, key = u.Host[:i], path
+	} else if i := strings.Index(u.Host, ".s3-"); i > 0 {
+		bucket, key = u.Host[:i], path
+	}
+	return bucket, key, bucket != "" && key != ""
+}
+
+func splitBucketKey(path string) (bucket string, key string) {
+	parts := strings.SplitN(path, "/", 2)
+	if len(parts) != 2 {
+		return parts[0], ""
+	}
+	return parts[0], parts[1]
+}
+
+// S3ObjectUrl returns the URL of an S3 object in the form accepted by the
+// TemplateURL of CloudFormation. Without a region the global endpoint is used.
+func S3ObjectUrl(endpoint string, region string, bucket string, key string) string {
+	if endpoint != "" {
+		return fmt.Sprintf("%s/%s/%s", strings.TrimSuffix(endpoint, "/"), bucket, key)
+	}
+	if region == "" {
+		return fmt.Sprintf("https://%s.s3.amazonaws.com/%s", bucket, key)
+	}
+	return fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", bucket, region, key)
+}
+
+// TemplateUrl returns the TemplateURL for a template location, s3:// URLs are
+// converted to https
+func TemplateUrl(location string, endpoint string) (string, error) {
+	if !strings.HasPrefix(location, "s3://") {
+		return location, nil
+	}
+	bucket, key, ok := ParseS3Url(location, endpoint)
+	if !ok {
+		return "", fmt.Errorf("invalid S3 URL %q, expected s3://bucket/key", location)
+	}
+	return S3ObjectUrl(endpoint, "", bucket, key), nil
+}
+
+// TemplateS3Key returns a new key to upload a template, unique to the run so
+// that giff deletes only the objects it uploaded. It's not named after the
+// MD5 of the template like the AWS CLI does.
+func TemplateS3Key(prefix string) string {
+	key := changesetBaseName + "-" + uniuri.New() + ".template"
+	prefix = strings.Trim(prefix, "/")
+	if prefix == "" {
+		return key
+	}
+	return prefix + "/" + key
+}
@@ -0,0 +1,59 @@
+package pkg
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseS3Url(t *testing.T) {
+	tests := []struct {
+		location string
+		endpoint string
+		bucket   string
+		key      string
+		ok       bool
+	}{
+		{"s3://bucket/dir/template.yaml", "", "bucket", "dir/template.yaml", true},
+		{"s3://bucket", "", "bucket", "", false},
+		{"https://bucket.s3.amazonaws.com/template.yaml", "", "bucket", "template.yaml", true},
+		{"https://bucket.s3.eu-west-1.amazonaws.com/dir/template.yaml", "", "bucket", "dir/template.yaml", true},
+		{"https://bucket.s3-eu-west-1.amazonaws.com/template.yaml", "", "bucket", "template.yaml", true},
+		{"https://s3.eu-west-1.amazonaws.com/bucket/template.yaml", "", "bucket", "template.yaml", true},
+		{"http://localhost:4566/bucket/template.yaml", "http://localhost:4566", "bucket", "template.yaml", true},
+		{"https://example.com/template.yaml", "", "", "", false},
+	}
+	for _, test := range tests {
+		bucket, key, ok := ParseS3Url(test.location, test.endpoint)
+		assert.Equal(t, test.ok, ok, test.location)
+		if test.ok {
+			assert.Equal(t, test.bucket, bucket, test.location)
+			assert.Equal(t, test.key, key, test.location)
+		}
+	}
+}
+
+func TestS3ObjectUrl(t *testing.T) {
+	assert.Equal(t, "https://bucket.s3.amazonaws.com/key", S3ObjectUrl("", "", "bucket", "key"))
+	assert.Equal(t, "https://bucket.s3.eu-west-1.amazonaws.com/key", S3ObjectUrl("", "eu-west-1", "bucket", "key"))
+	assert.Equal(t, "http://localhost:4566/bucket/key", S3ObjectUrl("http://localhost:4566/", "eu-west-1", "bucket", "key"))
+}
+
+func TestTemplateUrl(t *testing.T) {
+	url, err := TemplateUrl("s3://bucket/template.yaml", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://bucket.s3.amazonaws.com/template.yaml", url)
+
+	url, err = TemplateUrl("https://example.com/template.yaml", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://example.com/template.yaml", url)
+
+	_, err = TemplateUrl("s3://bucket", "")
+	assert.Error(t, err)
+}
+
+func TestTemplateS3Key(t *testing.T) {
+	assert.Regexp(t, `^giff-[A-Za-z0-9]{16}\.template$`, TemplateS3Key(""))
+	assert.Regexp(t, `^dir/giff-[A-Za-z0-9]{16}\.template$`, TemplateS3Key("/dir/"))
+	assert.NotEqual(t, TemplateS3Key(""), TemplateS3Key(""))
+}
@@ -0,0 +1,75 @@
+package pkg
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTemplate_short_form(t *testing.T) {
+	template, err := ParseTemplate([]byte(`
+Resources:
+  Role:
+    Type: AWS::IAM::Role
+    Properties:
+      RoleName: !Sub ${AWS::StackName}-role
+      Arn: !GetAtt Other.Arn
+      Policies: [!Ref Policy, !Join [",", [a, b]]]
+      Enabled: True
+      Port: 80
+      Empty:
+`))
+	assert.NoError(t, err)
+	assert.Equal(t,
+		Template{
+			"Resources": map[string]interface{}{
+				"Role": map[string]interface{}{
+					"Type": "AWS::IAM::Role",
+					"Properties": map[string]interface{}{
+						"RoleName": map[string]interface{}{"Fn::Sub": "${AWS::StackName}-role"},
+						"Arn":      map[string]interface{}{"Fn::GetAtt": []interface{}{"Other", "Arn"}},
+						"Policies": []interface{}{
+							map[string]interface{}{"Ref": "Policy"},
+							map[string]interface{}{"Fn::Join": []interface{}{",", []interface{}{"a", "b"}}},
+						},
+						"Enabled": "true",
+						"Port":    "80",
+						"Empty":   nil,
+					},
+				},
+			},
+		},
+		template)
+}
+
+func TestParseTemplate_json(t *testing.T) {
+	yamlTemplate, err := ParseTemplate([]byte(`
+Resources:
+  Role:
+    Type: AWS::IAM::Role
+    Properties:
+      Arn: !GetAtt Other.Arn
+      Port: "80"
+      Enabled: true
+`))
+	assert.NoError(t, err)
+	jsonTemplate, err := ParseTemplate([]byte(`{
+		"Resources": {
+			"Role": {
+				"Type": "AWS::IAM::Role",
+				"Properties": {"Arn": {"Fn::GetAtt": ["Other", "Arn"]}, "Port": 80, "Enabled": true}
+			}
+		}
+	}`))
+	assert.NoError(t, err)
+	assert.Equal(t, yamlTemplate, jsonTemplate)
+}
+
+func TestParseTemplate_errors(t *testing.T) {
+	_, err := ParseTemplate([]byte(""))
+	assert.EqualError(t, err, "cannot parse the template: empty template")
+	_, err = ParseTemplate([]byte("- a\n- b\n"))
+	assert.EqualError(t, err, "cannot parse the template: not a mapping")
+	_, err = ParseTemplate([]byte("Value: !GetAtt Resource\n"))
+	assert.EqualError(t, err, "cannot parse the template: line 1: invalid !GetAtt \"Resource\"")
+}
@@ -0,0 +1,254 @@
+package pkg
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// DefaultContextLines is the number of context lines of diff -u
+const DefaultContextLines = 3
+
+// UnifiedDiff returns the differences between old and new in the unified
+// format of diff -u, with contextLines lines of context around every change.
+// The result is empty if old and new are equal.
+func UnifiedDiff(oldName string, newName string, old []byte, new []byte, contextLines int) []byte {
+	a := splitLines(old)
+	b := splitLines(new)
+	ops := diffLines(a, b)
+
+	var out bytes.Buffer
+	for _, h := range groupHunks(ops, contextLines) {
+		if out.Len() == 0 {
+			fmt.Fprintf(&out, "--- %s\n+++ %s\n", oldName, newName)
+		}
+		writeHunk(&out, ops[h.start:h.end], a, b)
+	}
+	return out.Bytes()
+}
+
+// splitLines splits data in lines keeping the line terminators, so that a
+// missing newline at the end of the file is a difference too
+func splitLines(data []byte) []string {
+	if len(data) == 0 {
+		return nil
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+type diffOpKind int
+
+const (
+	diffEqual diffOpKind = iota
+	diffDelete
+	diffInsert
+)
+
+// diffOp is one line of the edit script, a and b are the indexes of the line
+// in the old and in the new lines (or where it would be)
+type diffOp struct {
+	kind diffOpKind
+	a    int
+	b    int
+}
+
+// diffLines returns the shortest edit script that turns a into b
+func diffLines(a, b []string) []diffOp {
+	d := lineDiffer{
+		a:        a,
+		b:        b,
+		deleted:  make([]bool, len(a)),
+		inserted: make([]bool, len(b)),
+	}
+	d.compare(0, len(a), 0, len(b))
+
+	var ops []diffOp
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && d.deleted[i]:
+			ops = append(ops, diffOp{diffDelete, i, j})
+			i++
+		case j < len(b) && d.inserted[j]:
+			ops = append(ops, diffOp{diffInsert, i, j})
+			j++
+		default:
+			ops = append(ops, diffOp{diffEqual, i, j})
+			i++
+			j++
+		}
+	}
+	return ops
+}
+
+// lineDiffer implements the linear space version of the Myers' algorithm
+// described in "An O(ND) Difference Algorithm and Its Variations"
+type lineDiffer struct {
+	a        []string
+	b        []string
+	deleted  []bool
+	inserted []bool
+}
+
+func (d *lineDiffer) compare(aLo, aHi, bLo, bHi int) {
+	for aLo < aHi && bLo < bHi && d.a[aLo] == d.b[bLo] {
+		aLo++
+		bLo++
+	}
+	for aLo < aHi && bLo < bHi && d.a[aHi-1] == d.b[bHi-1] {
+		aHi--
+		bHi--
+	}
+	switch {
+	case aLo == aHi:
+		for j := bLo; j < bHi; j++ {
+			d.inserted[j] = true
+		}
+	case bLo == bHi:
+		for i := aLo; i < aHi; i++ {
+			d.deleted[i] = true
+		}
+	default:
+		x, y := d.middleSnake(aLo, aHi, bLo, bHi)
+		d.compare(aLo, x, bLo, y)
+		d.compare(x, aHi, y, bHi)
+	}
+}
+
+// middleSnake returns a point of an optimal path from (aLo, bLo) to (aHi,
+// bHi) that splits it in two paths with about the same number of edits
+func (d *lineDiffer) middleSnake(aLo, aHi, bLo, bHi int) (int, int) {
+	n := aHi - aLo
+	m := bHi - bLo
+	delta := n - m
+	odd := delta%2 != 0
+	max := (n+m+1)/2 + 1
+	off := max + 1
+	// furthest x reached on every diagonal, forward from the start and
+	// backward from the end (counting the x steps from the end)
+	vf := make([]int, 2*off+1)
+	vb := make([]int, 2*off+1)
+
+	for dd := 0; dd <= max; dd++ {
+		for k := -dd; k <= dd; k += 2 {
+			var x int
+			if k == -dd || (k != dd && vf[off+k-1] < vf[off+k+1]) {
+				x = vf[off+k+1]
+			} else {
+				x = vf[off+k-1] + 1
+			}
+			y := x - k
+			x0, y0 := x, y
+			for x < n && y < m && d.a[aLo+x] == d.b[bLo+y] {
+				x++
+				y++
+			}
+			vf[off+k] = x
+			if kb := delta - k; odd && kb >= -(dd-1) && kb <= dd-1 && x+vb[off+kb] >= n {
+				return aLo + x0, bLo + y0
+			}
+		}
+		for k := -dd; k <= dd; k += 2 {
+			var x int
+			if k == -dd || (k != dd && vb[off+k-1] < vb[off+k+1]) {
+				x = vb[off+k+1]
+			} else {
+				x = vb[off+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && d.a[aHi-1-x] == d.b[bHi-1-y] {
+				x++
+				y++
+			}
+			vb[off+k] = x
+			if kf := delta - k; !odd && kf >= -dd && kf <= dd && vf[off+kf]+x >= n {
+				return aHi - x, bHi - y
+			}
+		}
+	}
+	// not reachable, the paths always meet within max steps
+	return aLo + n/2, bLo + m/2
+}
+
+type hunk struct {
+	start int
+	end   int
+}
+
+// groupHunks returns the ranges of ops to print, the changes closer than
+// 2*contextLines are printed in the same hunk
+func groupHunks(ops []diffOp, contextLines int) []hunk {
+	if contextLines < 0 {
+		contextLines = 0
+	}
+	var hunks []hunk
+	for i := 0; i < len(ops); i++ {
+		if ops[i].kind == diffEqual {
+			continue
+		}
+		start := i - contextLines
+		if start < 0 {
+			start = 0
+		}
+		if len(hunks) > 0 && start <= hunks[len(hunks)-1].end {
+			start = hunks[len(hunks)-1].start
+			hunks = hunks[:len(hunks)-1]
+		}
+		for i < len(ops) && ops[i].kind != diffEqual {
+			i++
+		}
+		end := i + contextLines
+		if end > len(ops) {
+			end = len(ops)
+		}
+		hunks = append(hunks, hunk{start, end})
+	}
+	return hunks
+}
+
+func writeHunk(out *bytes.Buffer, ops []diffOp, a, b []string) {
+	aCount, bCount := 0, 0
+	for _, op := range ops {
+		if op.kind != diffInsert {
+			aCount++
+		}
+		if op.kind != diffDelete {
+			bCount++
+		}
+	}
+	fmt.Fprintf(out, "@@ -%s +%s @@\n", hunkRange(ops[0].a, aCount), hunkRange(ops[0].b, bCount))
+	for _, op := range ops {
+		switch op.kind {
+		case diffEqual:
+			writeLine(out, ' ', a[op.a])
+		case diffDelete:
+			writeLine(out, '-', a[op.a])
+		case diffInsert:
+			writeLine(out, '+', b[op.b])
+		}
+	}
+}
+
+// hunkRange formats a range like diff -u: an empty range starts at the line
+// before it and the length of single line ranges is omitted
+func hunkRange(start int, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", start)
+	case 1:
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+func writeLine(out *bytes.Buffer, prefix byte, line string) {
+	out.WriteByte(prefix)
+	out.WriteString(line)
+	if !strings.HasSuffix(line, "\n") {
+		out.WriteString("\n\\ No newline at end of file\n")
+	}
+}
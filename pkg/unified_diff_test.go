@@ -0,0 +1,82 @@
+package pkg
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnifiedDiff_equal(t *testing.T) {
+	assert.Empty(t, UnifiedDiff("old", "new", []byte("a\nb\n"), []byte("a\nb\n"), 3))
+	assert.Empty(t, UnifiedDiff("old", "new", nil, nil, 3))
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	old := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n"
+	new := "1\n2\nthree\n4\n5\n6\n7\n8\n9\n10\n12\n13\n"
+	assert.Equal(t,
+		"--- old\n"+
+			"+++ new\n"+
+			"@@ -1,6 +1,6 @@\n"+
+			" 1\n"+
+			" 2\n"+
+			"-3\n"+
+			"+three\n"+
+			" 4\n"+
+			" 5\n"+
+			" 6\n"+
+			"@@ -8,5 +8,5 @@\n"+
+			" 8\n"+
+			" 9\n"+
+			" 10\n"+
+			"-11\n"+
+			" 12\n"+
+			"+13\n",
+		string(UnifiedDiff("old", "new", []byte(old), []byte(new), 3)))
+
+	assert.Equal(t,
+		"--- old\n"+
+			"+++ new\n"+
+			"@@ -3 +3 @@\n"+
+			"-3\n"+
+			"+three\n"+
+			"@@ -11 +10,0 @@\n"+
+			"-11\n"+
+			"@@ -12,0 +12 @@\n"+
+			"+13\n",
+		string(UnifiedDiff("old", "new", []byte(old), []byte(new), 0)))
+}
+
+func TestUnifiedDiff_no_newline(t *testing.T) {
+	assert.Equal(t,
+		"--- old\n"+
+			"+++ new\n"+
+			"@@ -1,2 +1,2 @@\n"+
+			" a\n"+
+			"-b\n"+
+			"\\ No newline at end of file\n"+
+			"+b\n",
+		string(UnifiedDiff("old", "new", []byte("a\nb"), []byte("a\nb\n"), 3)))
+}
+
+func TestUnifiedDiff_empty_file(t *testing.T) {
+	assert.Equal(t,
+		"--- old\n"+
+			"+++ new\n"+
+			"@@ -0,0 +1,2 @@\n"+
+			"+a\n"+
+			"+b\n",
+		string(UnifiedDiff("old", "new", nil, []byte("a\nb\n"), 3)))
+}
+
+func TestDiffLines_minimal(t *testing.T) {
+	a := splitLines([]byte("a\nb\nc\na\nb\nb\na\n"))
+	b := splitLines([]byte("c\nb\na\nb\na\nc\n"))
+	edits := 0
+	for _, op := range diffLines(a, b) {
+		if op.kind != diffEqual {
+			edits++
+		}
+	}
+	assert.Equal(t, 5, edits)
+}
@@ -0,0 +1,144 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	cf "github.com/aws/aws-sdk-go-v2/service/cloudformation"
+	cfTypes "github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
+	"github.com/aws/smithy-go"
+)
+
+const (
+	// DefaultWaitTimeout is the time WaitForChangeSet waits by default
+	DefaultWaitTimeout = 10 * time.Minute
+	minWaitDelay       = 1 * time.Second
+	maxWaitDelay       = 30 * time.Second
+)
+
+// Clock is the time source of WaitForChangeSet
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// SystemClock is the Clock of the time package
+type SystemClock struct{}
+
+func (SystemClock) Now() time.Time                         { return time.Now() }
+func (SystemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// WaitOptions configures WaitForChangeSet, the zero value waits
+// DefaultWaitTimeout with the SystemClock
+type WaitOptions struct {
+	Timeout time.Duration
+	Clock   Clock
+}
+
+// WaitForChangeSet polls the changeset until it's created or failed. The
+// delay between the polls grows exponentially, with jitter, up to
+// maxWaitDelay; throttled requests are retried with the same backoff. It
+// stops with an error after the timeout, or with the error of the context
+// when it's cancelled.
+// no waiters in the aws-sdk-go-v2 for cloudformation yet
+// https://github.com/aws/aws-sdk-go-v2/issues/1111
+func WaitForChangeSet(ctx context.Context, api CFAPI, changeSetArn string, options WaitOptions, print func(string, ...interface{})) (*cf.DescribeChangeSetOutput, error) {
+	clock := options.Clock
+	if clock == nil {
+		clock = SystemClock{}
+	}
+	timeout := options.Timeout
+	if timeout <= 0 {
+		timeout = DefaultWaitTimeout
+	}
+	deadline := clock.Now().Add(timeout)
+	delay := minWaitDelay
+	print("Reading changeset...")
+	for {
+		out, err := api.DescribeChangeSet(ctx, &cf.DescribeChangeSetInput{
+			ChangeSetName: aws.String(changeSetArn),
+		})
+		switch {
+		case IsThrottlingError(err):
+			// the SDK retries are over, slow down and keep waiting
+		case err != nil:
+			print("\n")
+			return nil, err
+		case out.Status == cfTypes.ChangeSetStatusCreateComplete || out.Status == cfTypes.ChangeSetStatusFailed:
+			if err = readChangeSetPages(ctx, api, changeSetArn, out); err != nil {
+				print("\n")
+				return nil, err
+			}
+			print("ok\n")
+			return out, nil
+		}
+
+		remaining := deadline.Sub(clock.Now())
+		if remaining <= 0 {
+			print("\n")
+			return nil, fmt.Errorf("timeout after %s waiting for changeset %s", timeout, changeSetArn)
+		}
+		wait := withJitter(delay)
+		if wait > remaining {
+			wait = remaining
+		}
+		select {
+		case <-ctx.Done():
+			print("\n")
+			return nil, ctx.Err()
+		case <-clock.After(wait):
+		}
+		print(".")
+		delay *= 2
+		if delay > maxWaitDelay {
+			delay = maxWaitDelay
+		}
+	}
+}
+
+// withJitter returns a random duration between d/2 and d
+func withJitter(d time.Duration) time.Duration {
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// IsThrottlingError tells if err is the error of a throttled request
+func IsThrottlingError(err error) bool {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	switch apiErr.ErrorCode() {
+	case "Throttling", "ThrottlingException", "RequestLimitExceeded":
+		return true
+	}
+	return false
+}
+
+// IsEmptyChangeSet tells if the changeset failed only because the template
+// and the parameters didn't change the stack
+func IsEmptyChangeSet(out *cf.DescribeChangeSetOutput) bool {
+	if out.Status != cfTypes.ChangeSetStatusFailed {
+		return false
+	}
+	reason := aws.ToString(out.StatusReason)
+	return strings.Contains(reason, "didn't contain changes") || strings.Contains(reason, "No updates are to be performed")
+}
+
+// ChangeSetError returns the error of a failed changeset, with its
+// StatusReason and ExecutionStatus. It's nil for the changesets that didn't
+// fail and for the empty ones.
+func ChangeSetError(out *cf.DescribeChangeSetOutput) error {
+	if out.Status != cfTypes.ChangeSetStatusFailed || IsEmptyChangeSet(out) {
+		return nil
+	}
+	name := aws.ToString(out.ChangeSetName)
+	if name == "" {
+		name = aws.ToString(out.ChangeSetId)
+	}
+	return fmt.Errorf("changeset %s failed: %s (execution status: %s)", name, aws.ToString(out.StatusReason), out.ExecutionStatus)
+}
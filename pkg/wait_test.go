@@ -0,0 +1,140 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	cf "github.com/aws/aws-sdk-go-v2/service/cloudformation"
+	cfTypes "github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClock moves forward when After is called, recording the delays
+type fakeClock struct {
+	now    time.Time
+	delays []time.Duration
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.delays = append(c.delays, d)
+	c.now = c.now.Add(d)
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return ch
+}
+
+// MockCFClientWait returns the given DescribeChangeSet errors, then
+// CREATE_IN_PROGRESS until the changeset is complete after inProgress calls
+type MockCFClientWait struct {
+	CFAPI
+	errs       []error
+	inProgress int
+	calls      int
+}
+
+func (client *MockCFClientWait) DescribeChangeSet(ctx context.Context, params *cf.DescribeChangeSetInput) (*cf.DescribeChangeSetOutput, error) {
+	client.calls++
+	if len(client.errs) > 0 {
+		err := client.errs[0]
+		client.errs = client.errs[1:]
+		return nil, err
+	}
+	if client.inProgress > 0 {
+		client.inProgress--
+		return &cf.DescribeChangeSetOutput{Status: cfTypes.ChangeSetStatusCreateInProgress}, nil
+	}
+	return &cf.DescribeChangeSetOutput{Status: cfTypes.ChangeSetStatusCreateComplete}, nil
+}
+
+func noPrint(string, ...interface{}) {}
+
+func TestWaitForChangeSet_pages(t *testing.T) {
+	out, err := WaitForChangeSet(context.Background(), MockCFClientPages{pages: 3}, "changeset", WaitOptions{}, noPrint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes, _ := ExtractChanges(out)
+	assert.Len(t, changes, 3)
+	assert.Equal(t, "Resource2", *changes[2].LogicalResourceId)
+	assert.Nil(t, out.NextToken)
+}
+
+func TestWaitForChangeSet_backoff(t *testing.T) {
+	clock := &fakeClock{}
+	client := &MockCFClientWait{inProgress: 8}
+	out, err := WaitForChangeSet(context.Background(), client, "changeset", WaitOptions{Clock: clock}, noPrint)
+	assert.NoError(t, err)
+	assert.Equal(t, cfTypes.ChangeSetStatusCreateComplete, out.Status)
+	assert.Equal(t, 9, client.calls)
+	expected := []time.Duration{1, 2, 4, 8, 16, 30, 30, 30}
+	assert.Len(t, clock.delays, len(expected))
+	for i, d := range clock.delays {
+		max := expected[i] * time.Second
+		assert.True(t, d >= max/2 && d <= max, "delay %d is %s, expected between %s and %s", i, d, max/2, max)
+	}
+}
+
+func TestWaitForChangeSet_throttling(t *testing.T) {
+	clock := &fakeClock{}
+	throttling := &smithy.GenericAPIError{Code: "Throttling", Message: "Rate exceeded"}
+	client := &MockCFClientWait{errs: []error{throttling, throttling}}
+	out, err := WaitForChangeSet(context.Background(), client, "changeset", WaitOptions{Clock: clock}, noPrint)
+	assert.NoError(t, err)
+	assert.Equal(t, cfTypes.ChangeSetStatusCreateComplete, out.Status)
+	assert.Len(t, clock.delays, 2)
+
+	client = &MockCFClientWait{errs: []error{errors.New("access denied")}}
+	_, err = WaitForChangeSet(context.Background(), client, "changeset", WaitOptions{Clock: clock}, noPrint)
+	assert.EqualError(t, err, "access denied")
+}
+
+func TestWaitForChangeSet_timeout(t *testing.T) {
+	clock := &fakeClock{}
+	client := &MockCFClientWait{inProgress: 1000}
+	_, err := WaitForChangeSet(context.Background(), client, "changeset", WaitOptions{Timeout: time.Minute, Clock: clock}, noPrint)
+	assert.EqualError(t, err, "timeout after 1m0s waiting for changeset changeset")
+	assert.Equal(t, time.Minute, clock.now.Sub(time.Time{}))
+}
+
+func TestWaitForChangeSet_cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := WaitForChangeSet(ctx, &MockCFClientWait{inProgress: 1}, "changeset", WaitOptions{}, noPrint)
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestIsThrottlingError(t *testing.T) {
+	assert.True(t, IsThrottlingError(&smithy.GenericAPIError{Code: "Throttling"}))
+	assert.False(t, IsThrottlingError(&smithy.GenericAPIError{Code: "ValidationError"}))
+	assert.False(t, IsThrottlingError(errors.New("Throttling")))
+	assert.False(t, IsThrottlingError(nil))
+}
+
+func TestChangeSetError(t *testing.T) {
+	complete := &cf.DescribeChangeSetOutput{Status: cfTypes.ChangeSetStatusCreateComplete}
+	assert.False(t, IsEmptyChangeSet(complete))
+	assert.NoError(t, ChangeSetError(complete))
+
+	for _, reason := range []string{
+		"The submitted information didn't contain changes. Submit different information to create a change set.",
+		"No updates are to be performed.",
+	} {
+		empty := &cf.DescribeChangeSetOutput{Status: cfTypes.ChangeSetStatusFailed, StatusReason: aws.String(reason)}
+		assert.True(t, IsEmptyChangeSet(empty))
+		assert.NoError(t, ChangeSetError(empty))
+	}
+
+	failed := &cf.DescribeChangeSetOutput{
+		ChangeSetName:   aws.String("giff-1234"),
+		Status:          cfTypes.ChangeSetStatusFailed,
+		StatusReason:    aws.String("No export named vpc-id found"),
+		ExecutionStatus: cfTypes.ExecutionStatusUnavailable,
+	}
+	assert.False(t, IsEmptyChangeSet(failed))
+	assert.EqualError(t, ChangeSetError(failed), "changeset giff-1234 failed: No export named vpc-id found (execution status: UNAVAILABLE)")
+}